@@ -0,0 +1,574 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	alertOK       = "ok"
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+
+	signatureHeader = "X-Charly-Signature"
+)
+
+// AlertSettings configure the evaluation of the alert rules.
+type AlertSettings struct {
+	// Interval is the time between two evaluations of the rules.
+	Interval time.Duration
+	// Secret signs the webhook payloads. Without it the rules are neither
+	// evaluated nor accepted.
+	Secret string
+	// Queue is the number of notifications waiting for delivery to each
+	// webhook before new ones are dropped.
+	Queue int
+	// WebhookHosts lists the webhook hosts notifications may be posted to
+	// even though they resolve to a loopback, link-local or private address.
+	WebhookHosts []string
+}
+
+func DefaultAlertSettings() AlertSettings {
+	return AlertSettings{
+		Interval: time.Minute,
+		Queue:    100,
+	}
+}
+
+// WebhookRetryPolicy retries webhook deliveries for about a minute.
+func WebhookRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Second * 30,
+		Jitter:      0.5,
+		RetryStatuses: map[int]bool{
+			http.StatusTooManyRequests:     true,
+			http.StatusInternalServerError: true,
+			http.StatusBadGateway:          true,
+			http.StatusServiceUnavailable:  true,
+			http.StatusGatewayTimeout:      true,
+		},
+		RetryError: isTransientNetworkError,
+	}
+}
+
+// AlertRule fires when Metric compares to Threshold for at least Duration
+// (eg. 10m), and resolves as soon as it no longer does.
+type AlertRule struct {
+	ID         string  `json:"id" yaml:"id"`
+	Metric     string  `json:"metric" yaml:"metric"`
+	Comparison string  `json:"comparison" yaml:"comparison"`
+	Threshold  float64 `json:"threshold" yaml:"threshold"`
+	Duration   string  `json:"duration,omitempty" yaml:"duration"`
+	Webhook    string  `json:"webhook" yaml:"webhook"`
+}
+
+// AlertStatus is a rule along with its current state.
+type AlertStatus struct {
+	Rule  AlertRule  `json:"rule"`
+	State string     `json:"state"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// AlertNotification is the payload posted to the webhook of a rule when it
+// fires or resolves. Values are in the upstream units.
+type AlertNotification struct {
+	Rule   AlertRule `json:"rule"`
+	Status string    `json:"status"`
+	Value  *float64  `json:"value,omitempty"`
+	Date   string    `json:"date"`
+	Since  time.Time `json:"since"`
+	Units  Units     `json:"units"`
+}
+
+type alertState struct {
+	rule      AlertRule
+	condition Condition
+	duration  time.Duration
+	state     string
+	since     time.Time
+}
+
+// Alerts evaluate the alert rules against the current weather and deliver
+// their notifications.
+type Alerts struct {
+	settings     AlertSettings
+	temperatures Gateway
+	speeds       Gateway
+	units        Units
+	client       *HttpClient
+	logger       zerolog.Logger
+
+	mu         sync.Mutex
+	rules      map[string]*alertState
+	deliveries map[string]chan AlertNotification
+	stop       chan struct{}
+}
+
+func NewAlerts(settings AlertSettings, temperatures Gateway, speeds Gateway, units Units, logger zerolog.Logger) *Alerts {
+	a := &Alerts{
+		settings:     settings,
+		temperatures: temperatures,
+		speeds:       speeds,
+		units:        units,
+		logger:       logger,
+		rules:        make(map[string]*alertState),
+		deliveries:   make(map[string]chan AlertNotification),
+	}
+	a.client = &HttpClient{
+		client: &http.Client{
+			Timeout:   DefaultHttpSettings().Timeout,
+			Transport: &http.Transport{DialContext: a.dialWebhook},
+		},
+		retry:  WebhookRetryPolicy(),
+		logger: logger,
+	}
+	return a
+}
+
+// Load adds the rules listed in the YAML (or JSON) file at path.
+func (a *Alerts) Load(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rules []AlertRule
+	if err := yaml.Unmarshal(content, &rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if httpError := a.Put(rule); httpError != nil {
+			return fmt.Errorf("%s: rule %s: %s", path, rule.ID, httpError.Message)
+		}
+	}
+	return nil
+}
+
+// Put adds or replaces a rule. A rule without id is given one. A rule
+// replaced by one with the same condition, duration and webhook keeps its
+// state, otherwise its state is reset, once a firing rule resolved.
+func (a *Alerts) Put(rule AlertRule) *HttpError {
+	state, err := newAlertState(rule)
+	if err != nil {
+		return err
+	}
+	if err := a.checkWebhook(rule.Webhook); err != nil {
+		return err
+	}
+	if state.rule.ID == "" {
+		state.rule.ID = uuid.New().String()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if previous, ok := a.rules[state.rule.ID]; ok {
+		if previous.condition == state.condition && previous.duration == state.duration && previous.rule.Webhook == state.rule.Webhook {
+			state.state = previous.state
+			state.since = previous.since
+		} else {
+			a.resolve(previous)
+		}
+	}
+	a.rules[state.rule.ID] = state
+	return nil
+}
+
+// resolve queues a resolved notification for a firing rule about to be
+// replaced or removed, so that its webhook does not wait for one forever.
+// The lock must be held.
+func (a *Alerts) resolve(state *alertState) {
+	if state.state != alertFiring {
+		return
+	}
+	a.enqueue(AlertNotification{
+		Rule:   state.rule,
+		Status: alertResolved,
+		Date:   time.Now().UTC().Format(time.RFC3339),
+		Since:  state.since,
+		Units:  a.units,
+	})
+}
+
+func newAlertState(rule AlertRule) (*alertState, *HttpError) {
+	if !contains(conditionMetrics, rule.Metric) {
+		return nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a metric among " + strings.Join(conditionMetrics, ", ")}
+	}
+	if !contains(conditionOperators, rule.Comparison) {
+		return nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a comparison among " + strings.Join(conditionOperators, ", ")}
+	}
+	var duration time.Duration
+	if rule.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(rule.Duration); err != nil || duration < 0 {
+			return nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a duration such as 10m"}
+		}
+	}
+	webhook, err := url.Parse(rule.Webhook)
+	if err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+		return nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide an http or https webhook"}
+	}
+
+	return &alertState{
+		rule:      rule,
+		condition: Condition{rule.Metric, rule.Comparison, rule.Threshold},
+		duration:  duration,
+		state:     alertOK,
+	}, nil
+}
+
+// checkWebhook refuses the webhooks resolving to a loopback, link-local or
+// private address, so that rules cannot reach the services next to this one,
+// unless their host is allowed.
+func (a *Alerts) checkWebhook(webhook string) *HttpError {
+	parsed, err := url.Parse(webhook)
+	if err != nil {
+		return &HttpError{http.StatusText(http.StatusBadRequest), "Please provide an http or https webhook"}
+	}
+	host := parsed.Hostname()
+	if a.allowedHost(host) {
+		return nil
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a webhook whose host resolves"}
+	}
+	for _, address := range addresses {
+		if !isPublicAddress(address.IP) {
+			return &HttpError{http.StatusText(http.StatusBadRequest),
+				"Please provide a webhook outside of the private networks, or allow its host in alerts.webhook_hosts"}
+		}
+	}
+	return nil
+}
+
+func (a *Alerts) allowedHost(host string) bool {
+	for _, allowed := range a.settings.WebhookHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialWebhook connects to a webhook. Unless its host is allowed, it refuses
+// to connect to a loopback, link-local or private address, which a host may
+// resolve to once its rule was accepted.
+func (a *Alerts) dialWebhook(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: DefaultHttpSettings().Timeout}
+	if host, _, err := net.SplitHostPort(address); err == nil && a.allowedHost(host) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !isPublicAddress(ip) {
+			return fmt.Errorf("webhook address %s is not public", host)
+		}
+		return nil
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func isPublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsPrivate() && !ip.IsUnspecified()
+}
+
+// Get returns the status of a rule.
+func (a *Alerts) Get(id string) (AlertStatus, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, ok := a.rules[id]
+	if !ok {
+		return AlertStatus{}, false
+	}
+	return state.status(), true
+}
+
+// List returns the status of every rule, ordered by id.
+func (a *Alerts) List() []AlertStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	statuses := []AlertStatus{}
+	for _, state := range a.rules {
+		statuses = append(statuses, state.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Rule.ID < statuses[j].Rule.ID
+	})
+	return statuses
+}
+
+// Delete removes a rule, reporting whether it existed. A firing rule is
+// resolved.
+func (a *Alerts) Delete(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, ok := a.rules[id]
+	if ok {
+		a.resolve(state)
+	}
+	delete(a.rules, id)
+	return ok
+}
+
+func (s *alertState) status() AlertStatus {
+	status := AlertStatus{Rule: s.rule, State: s.state}
+	if s.state != alertOK {
+		since := s.since
+		status.Since = &since
+	}
+	return status
+}
+
+// Enabled reports whether the rules may be evaluated, which takes a secret to
+// sign their notifications.
+func (a *Alerts) Enabled() bool {
+	return a.settings.Secret != ""
+}
+
+// Start evaluates the rules every interval and delivers their notifications
+// until Stop is called. Nothing is started without a secret.
+func (a *Alerts) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.Enabled() {
+		a.logger.Warn().Msg("Alerts are disabled, please configure an alerts secret to enable them")
+		return
+	}
+	if a.stop != nil {
+		return
+	}
+	a.stop = make(chan struct{})
+	go a.run(a.stop)
+}
+
+// Stop stops the evaluation and the delivery of the notifications.
+func (a *Alerts) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+		a.deliveries = make(map[string]chan AlertNotification)
+	}
+}
+
+func (a *Alerts) run(stop chan struct{}) {
+	ticker := time.NewTicker(a.settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.evaluate(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evaluate checks every rule against the weather at now, queuing a
+// notification for each rule that fires or resolves. Nothing is evaluated
+// when an upstream fails.
+func (a *Alerts) evaluate(now time.Time) {
+	a.mu.Lock()
+	empty := len(a.rules) == 0
+	a.mu.Unlock()
+	if empty {
+		return
+	}
+
+	weather, ok := currentWeather(context.Background(), now, a.temperatures, a.speeds, a.logger)
+	if !ok {
+		return
+	}
+	weather = allMetricsOptions(a.units).apply(weather).(Weather)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, state := range a.rules {
+		if status := state.evaluate(weather, now); status != "" {
+			notification := AlertNotification{Rule: state.rule, Status: status, Date: weather.Date, Since: state.since, Units: a.units}
+			if value, ok := metricValue(weather, state.rule.Metric); ok {
+				notification.Value = &value
+			}
+			a.enqueue(notification)
+		}
+	}
+}
+
+// evaluate moves the rule to its next state and returns the notification
+// status to send, if any.
+func (s *alertState) evaluate(weather Weather, now time.Time) string {
+	if !s.condition.Matches(weather) {
+		firing := s.state == alertFiring
+		s.state = alertOK
+		if firing {
+			return alertResolved
+		}
+		return ""
+	}
+
+	if s.state == alertOK {
+		s.state = alertPending
+		s.since = now
+	}
+	if s.state == alertPending && now.Sub(s.since) >= s.duration {
+		s.state = alertFiring
+		return alertFiring
+	}
+	return ""
+}
+
+// enqueue queues a notification for delivery to the webhook of its rule,
+// starting the delivery of the webhook on its first notification. The lock
+// must be held.
+func (a *Alerts) enqueue(notification AlertNotification) {
+	if a.stop == nil {
+		a.logger.Error().Str("rule", notification.Rule.ID).Msg("Alerts are stopped, dropping " + notification.Status)
+		return
+	}
+	webhook := notification.Rule.Webhook
+	queue, ok := a.deliveries[webhook]
+	if !ok {
+		queue = make(chan AlertNotification, a.settings.Queue)
+		a.deliveries[webhook] = queue
+		go a.deliver(queue, a.stop)
+	}
+
+	select {
+	case queue <- notification:
+	default:
+		a.logger.Error().Str("rule", notification.Rule.ID).Str("webhook", webhook).Msg("Too many notifications waiting, dropping " + notification.Status)
+	}
+}
+
+// deliver posts the notifications queued for a webhook one at a time, so
+// that the webhook receives them in order. Each webhook has its own queue,
+// so that a slow one does not hold back the others.
+func (a *Alerts) deliver(queue chan AlertNotification, stop chan struct{}) {
+	for {
+		select {
+		case notification := <-queue:
+			a.post(notification)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// post sends a notification signed with an HMAC-SHA256 of the body, given
+// in hexadecimal as sha256=<signature>.
+func (a *Alerts) post(notification AlertNotification) {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		a.logger.Error().Str("rule", notification.Rule.ID).Msg("Failed to encode notification: " + err.Error())
+		return
+	}
+	header := http.Header{}
+	header.Set(signatureHeader, "sha256="+signPayload(a.settings.Secret, body))
+
+	if _, httpError := a.client.PostJSON(context.Background(), notification.Rule.Webhook, body, header); httpError != nil {
+		a.logger.Error().Str("rule", notification.Rule.ID).Msg("Failed to deliver " + notification.Status + " notification: " + httpError.Type + " " + httpError.Message)
+	}
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetAlerts lists every alert rule along with its state.
+func (m *Module) GetAlerts(c echo.Context) error {
+	return c.JSON(http.StatusOK, m.alerts.List())
+}
+
+func (m *Module) GetAlert(c echo.Context) error {
+	status, ok := m.alerts.Get(c.Param("id"))
+	if !ok {
+		return m.respondError(c, http.StatusNotFound, &HttpError{http.StatusText(http.StatusNotFound), "Alert not found for " + c.Param("id")})
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// alertsDisabled answers 403 to the calls adding rules while alerts are
+// disabled.
+func (m *Module) alertsDisabled(c echo.Context) error {
+	return m.respondError(c, http.StatusForbidden, &HttpError{http.StatusText(http.StatusForbidden),
+		"Please configure an alerts secret to enable alerts"})
+}
+
+// CreateAlert adds a rule, given an id when it has none.
+func (m *Module) CreateAlert(c echo.Context) error {
+	if !m.alerts.Enabled() {
+		return m.alertsDisabled(c)
+	}
+	var rule AlertRule
+	if err := c.Bind(&rule); err != nil {
+		return m.respondError(c, http.StatusBadRequest, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide an alert rule as JSON"})
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.New().String()
+	}
+	if _, ok := m.alerts.Get(rule.ID); ok {
+		return m.respondError(c, http.StatusConflict, &HttpError{http.StatusText(http.StatusConflict), "Alert already exists for " + rule.ID})
+	}
+	if err := m.alerts.Put(rule); err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	status, _ := m.alerts.Get(rule.ID)
+	return c.JSON(http.StatusCreated, status)
+}
+
+// UpdateAlert adds or replaces the rule at the given id.
+func (m *Module) UpdateAlert(c echo.Context) error {
+	if !m.alerts.Enabled() {
+		return m.alertsDisabled(c)
+	}
+	var rule AlertRule
+	if err := c.Bind(&rule); err != nil {
+		return m.respondError(c, http.StatusBadRequest, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide an alert rule as JSON"})
+	}
+	rule.ID = c.Param("id")
+	if err := m.alerts.Put(rule); err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	status, _ := m.alerts.Get(rule.ID)
+	return c.JSON(http.StatusOK, status)
+}
+
+func (m *Module) DeleteAlert(c echo.Context) error {
+	if !m.alerts.Delete(c.Param("id")) {
+		return m.respondError(c, http.StatusNotFound, &HttpError{http.StatusText(http.StatusNotFound), "Alert not found for " + c.Param("id")})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
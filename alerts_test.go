@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type AlertsTestSuite struct {
+	suite.Suite
+	alerts        *Alerts
+	receiver      *httptest.Server
+	notifications chan AlertNotification
+	failures      int32
+	start         time.Time
+}
+
+func TestAlertsTestSuite(t *testing.T) {
+	suite.Run(t, new(AlertsTestSuite))
+}
+
+func (suite *AlertsTestSuite) SetupTest() {
+	suite.start = time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC)
+	suite.notifications = make(chan AlertNotification, 10)
+	suite.failures = 0
+	suite.receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&suite.failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(signatureHeader) != "sha256="+signPayload("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var notification AlertNotification
+		_ = json.Unmarshal(body, &notification)
+		suite.notifications <- notification
+	}))
+
+	suite.alerts = NewAlerts(
+		AlertSettings{Interval: time.Hour, Secret: "secret", Queue: 10, WebhookHosts: []string{"127.0.0.1", "localhost"}},
+		&TemperatureGatewayMock{temperatures: map[string]Temperature{
+			"2018-08-01T00:00:00Z": {Temp: -2},
+			"2018-08-01T00:05:00Z": {Temp: -3},
+			"2018-08-01T00:10:00Z": {Temp: -1},
+			"2018-08-01T00:15:00Z": {Temp: 4},
+		}},
+		&currentGatewayMock{value: Windspeed{North: 1, West: 1}},
+		canonicalUnits,
+		newTestModule(suite.T(), DefaultConfig()).logger,
+	)
+	suite.alerts.client.retry = RetryPolicy{
+		MaxAttempts:   3,
+		BaseBackoff:   time.Millisecond,
+		RetryStatuses: map[int]bool{http.StatusServiceUnavailable: true},
+	}
+	suite.alerts.Start()
+}
+
+func (suite *AlertsTestSuite) TearDownTest() {
+	suite.alerts.Stop()
+	suite.receiver.Close()
+}
+
+func (suite *AlertsTestSuite) TestRuleShouldFireAfterDurationAndResolve() {
+	// Given
+	assert.Assert(suite.T(), suite.alerts.Put(AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Duration: "10m", Webhook: suite.receiver.URL}) == nil)
+
+	// When
+	suite.alerts.evaluate(suite.start)
+	suite.alerts.evaluate(suite.start.Add(time.Minute * 5))
+	status, _ := suite.alerts.Get("frost")
+	suite.alerts.evaluate(suite.start.Add(time.Minute * 10))
+	fired := suite.receive()
+	suite.alerts.evaluate(suite.start.Add(time.Minute * 15))
+	resolved := suite.receive()
+
+	// Then
+	assert.Equal(suite.T(), status.State, alertPending)
+	assert.Equal(suite.T(), fired.Status, alertFiring)
+	assert.Equal(suite.T(), fired.Rule.ID, "frost")
+	assert.Equal(suite.T(), *fired.Value, -1.0)
+	assert.Equal(suite.T(), fired.Date, "2018-08-01T00:10:00Z")
+	assert.Assert(suite.T(), fired.Since.Equal(suite.start))
+	assert.Equal(suite.T(), resolved.Status, alertResolved)
+	assert.Equal(suite.T(), *resolved.Value, 4.0)
+}
+
+func (suite *AlertsTestSuite) TestPutShouldResolveAFiringRuleBeforeReplacingIt() {
+	// Given
+	rule := AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: suite.receiver.URL}
+	assert.Assert(suite.T(), suite.alerts.Put(rule) == nil)
+	suite.alerts.evaluate(suite.start)
+	suite.receive()
+
+	// When
+	replaced := rule
+	replaced.Threshold = -5
+	err := suite.alerts.Put(replaced)
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	resolved := suite.receive()
+	assert.Equal(suite.T(), resolved.Status, alertResolved)
+	assert.Equal(suite.T(), resolved.Rule, rule)
+	assert.Assert(suite.T(), resolved.Value == nil)
+	assert.Assert(suite.T(), resolved.Since.Equal(suite.start))
+	status, _ := suite.alerts.Get("frost")
+	assert.Equal(suite.T(), status.State, alertOK)
+}
+
+func (suite *AlertsTestSuite) TestPutShouldKeepTheStateOfAnUnchangedRule() {
+	// Given
+	rule := AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: suite.receiver.URL}
+	assert.Assert(suite.T(), suite.alerts.Put(rule) == nil)
+	suite.alerts.evaluate(suite.start)
+	suite.receive()
+
+	// When
+	err := suite.alerts.Put(rule)
+	suite.alerts.evaluate(suite.start.Add(time.Minute * 5))
+	status, _ := suite.alerts.Get("frost")
+	suite.alerts.evaluate(suite.start.Add(time.Minute * 15))
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	assert.Equal(suite.T(), status.State, alertFiring)
+	assert.Assert(suite.T(), status.Since.Equal(suite.start))
+	resolved := suite.receive()
+	assert.Equal(suite.T(), resolved.Status, alertResolved)
+	assert.Equal(suite.T(), resolved.Date, "2018-08-01T00:15:00Z")
+}
+
+func (suite *AlertsTestSuite) TestDeleteShouldResolveAFiringRule() {
+	// Given
+	assert.Assert(suite.T(), suite.alerts.Put(AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: suite.receiver.URL}) == nil)
+	suite.alerts.evaluate(suite.start)
+	suite.receive()
+
+	// When
+	deleted := suite.alerts.Delete("frost")
+
+	// Then
+	assert.Assert(suite.T(), deleted)
+	assert.Equal(suite.T(), suite.receive().Status, alertResolved)
+}
+
+func (suite *AlertsTestSuite) TestDeliveryShouldRetryFailingWebhook() {
+	// Given
+	suite.failures = 2
+	assert.Assert(suite.T(), suite.alerts.Put(AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: suite.receiver.URL}) == nil)
+
+	// When
+	suite.alerts.evaluate(suite.start)
+
+	// Then
+	assert.Equal(suite.T(), suite.receive().Status, alertFiring)
+}
+
+func (suite *AlertsTestSuite) TestDeliveryShouldNotWaitForSlowWebhooks() {
+	// Given
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	assert.Assert(suite.T(), suite.alerts.Put(AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: slow.URL}) == nil)
+	suite.alerts.evaluate(suite.start)
+	assert.Assert(suite.T(), suite.alerts.Put(AlertRule{ID: "chill", Metric: "temp", Comparison: "<", Threshold: 1, Webhook: suite.receiver.URL}) == nil)
+
+	// When
+	suite.alerts.evaluate(suite.start.Add(time.Minute * 5))
+
+	// Then
+	notification := suite.receive()
+	assert.Equal(suite.T(), notification.Rule.ID, "chill")
+	assert.Equal(suite.T(), notification.Status, alertFiring)
+}
+
+func (suite *AlertsTestSuite) TestLoadShouldReadRulesFromYAML() {
+	// Given
+	path := filepath.Join(os.TempDir(), "charly-weather-alerts.yml")
+	defer os.Remove(path)
+	content := "- id: high-wind\n  metric: magnitude\n  comparison: '>'\n  threshold: 20\n  duration: 5m\n  webhook: http://localhost/hooks\n"
+	assert.NilError(suite.T(), ioutil.WriteFile(path, []byte(content), 0600))
+
+	// When
+	err := suite.alerts.Load(path)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.DeepEqual(suite.T(), suite.alerts.List(), []AlertStatus{{
+		Rule:  AlertRule{ID: "high-wind", Metric: "magnitude", Comparison: ">", Threshold: 20, Duration: "5m", Webhook: "http://localhost/hooks"},
+		State: alertOK,
+	}})
+}
+
+func (suite *AlertsTestSuite) TestAlertsAPIShouldCreateListAndDeleteRules() {
+	// Given
+	config := DefaultConfig()
+	config.AdminToken = "token"
+	config.Alerts.Secret = "secret"
+	config.Alerts.WebhookHosts = []string{"localhost"}
+	module := newTestModule(suite.T(), config)
+	router := echo.New()
+	module.RegisterRoutes(router)
+	rule := `{"id":"frost","metric":"temp","comparison":"<","threshold":0,"webhook":"http://localhost/hooks"}`
+
+	// When
+	created := serveWithToken(router, "POST", "/alerts", rule, "token")
+	duplicated := serveWithToken(router, "POST", "/alerts", rule, "token")
+	invalid := serveWithToken(router, "POST", "/alerts", `{"metric":"humidity","comparison":"<","webhook":"http://localhost/hooks"}`, "token")
+	listed := serveWithToken(router, "GET", "/alerts", "", "token")
+	deleted := serveWithToken(router, "DELETE", "/alerts/frost", "", "token")
+	missing := serveWithToken(router, "GET", "/alerts/frost", "", "token")
+
+	// Then
+	var statuses []AlertStatus
+	assert.Equal(suite.T(), created.Code, http.StatusCreated)
+	assert.Equal(suite.T(), duplicated.Code, http.StatusConflict)
+	assert.Equal(suite.T(), invalid.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(listed.Body.Bytes(), &statuses))
+	assert.DeepEqual(suite.T(), statuses, []AlertStatus{{
+		Rule:  AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: "http://localhost/hooks"},
+		State: alertOK,
+	}})
+	assert.Equal(suite.T(), deleted.Code, http.StatusNoContent)
+	assert.Equal(suite.T(), missing.Code, http.StatusNotFound)
+}
+
+func (suite *AlertsTestSuite) TestAlertsAPIShouldRefuseRulesWithoutSecret() {
+	// Given
+	config := DefaultConfig()
+	config.AdminToken = "token"
+	module := newTestModule(suite.T(), config)
+	router := echo.New()
+	module.RegisterRoutes(router)
+	rule := `{"metric":"temp","comparison":"<","threshold":0,"webhook":"http://localhost/hooks"}`
+
+	// When
+	created := serveWithToken(router, "POST", "/alerts", rule, "token")
+	updated := serveWithToken(router, "PUT", "/alerts/frost", rule, "token")
+
+	// Then
+	assert.Equal(suite.T(), created.Code, http.StatusForbidden)
+	assert.Equal(suite.T(), created.Body.String(), `{"type":"Forbidden","message":"Please configure an alerts secret to enable alerts"}`+"\n")
+	assert.Equal(suite.T(), updated.Code, http.StatusForbidden)
+	assert.Equal(suite.T(), len(module.alerts.List()), 0)
+}
+
+func (suite *AlertsTestSuite) TestAlertsAPIShouldRequireTheAdminToken() {
+	// Given
+	config := DefaultConfig()
+	config.AdminToken = "token"
+	config.Alerts.Secret = "secret"
+	module := newTestModule(suite.T(), config)
+	router := echo.New()
+	module.RegisterRoutes(router)
+	rule := `{"id":"frost","metric":"temp","comparison":"<","threshold":0,"webhook":"https://example.com/hooks"}`
+
+	// When
+	created := serve(router, "POST", "/alerts", rule)
+	updated := serveWithToken(router, "PUT", "/alerts/frost", rule, "guess")
+	listed := serve(router, "GET", "/alerts", "")
+
+	// Then
+	assert.Equal(suite.T(), created.Code, http.StatusUnauthorized)
+	assert.Equal(suite.T(), updated.Code, http.StatusUnauthorized)
+	assert.Equal(suite.T(), listed.Code, http.StatusUnauthorized)
+	assert.Equal(suite.T(), len(module.alerts.List()), 0)
+}
+
+func (suite *AlertsTestSuite) TestPutShouldRejectPrivateWebhooks() {
+	// Given
+	suite.alerts.settings.WebhookHosts = nil
+	webhooks := []string{"http://localhost/hooks", "http://127.0.0.1:8080/hooks", "http://10.0.0.1/hooks", "http://169.254.169.254/latest", "http://[::1]/hooks"}
+
+	// When
+	var errs []*HttpError
+	for _, webhook := range webhooks {
+		errs = append(errs, suite.alerts.Put(AlertRule{ID: "frost", Metric: "temp", Comparison: "<", Threshold: 0, Webhook: webhook}))
+	}
+
+	// Then
+	for _, err := range errs {
+		assert.DeepEqual(suite.T(), *err, HttpError{http.StatusText(http.StatusBadRequest),
+			"Please provide a webhook outside of the private networks, or allow its host in alerts.webhook_hosts"})
+	}
+	assert.Equal(suite.T(), len(suite.alerts.List()), 0)
+}
+
+func (suite *AlertsTestSuite) TestDeliveryShouldRefusePrivateAddresses() {
+	// Given
+	alerts := NewAlerts(AlertSettings{Secret: "secret"}, nil, nil, canonicalUnits, suite.alerts.logger)
+
+	// When
+	_, err := alerts.client.PostJSON(context.Background(), suite.receiver.URL, []byte("{}"), http.Header{})
+
+	// Then
+	assert.Assert(suite.T(), err != nil)
+	assert.Assert(suite.T(), strings.Contains(err.Message, "webhook address 127.0.0.1 is not public"))
+	assert.Equal(suite.T(), len(suite.notifications), 0)
+}
+
+func (suite *AlertsTestSuite) receive() AlertNotification {
+	select {
+	case notification := <-suite.notifications:
+		return notification
+	case <-time.After(time.Second):
+		suite.T().Fatal("no notification received")
+		return AlertNotification{}
+	}
+}
+
+func serve(router *echo.Echo, method string, target string, body string) *httptest.ResponseRecorder {
+	return serveWithToken(router, method, target, body, "")
+}
+
+func serveWithToken(router *echo.Echo, method string, target string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
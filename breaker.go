@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerSettings configures when a circuit breaker opens and how it recovers.
+type BreakerSettings struct {
+	// FailureThreshold is the number of consecutive failures opening the breaker.
+	FailureThreshold int
+	// CoolDown is how long the breaker stays open before letting a probe through.
+	CoolDown time.Duration
+	// SuccessThreshold is the number of successful probes closing the breaker again.
+	SuccessThreshold int
+}
+
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		FailureThreshold: 5,
+		CoolDown:         time.Second * 30,
+		SuccessThreshold: 1,
+	}
+}
+
+type BreakerStatus struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+	OpenedAt string       `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker tracks the health of an upstream. While open every call is
+// rejected until the cool-down elapses, then a single probe at a time is let
+// through in half-open state to decide whether to close again.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	settings  BreakerSettings
+	state     BreakerState
+	failures  int
+	successes int
+	openedAt  time.Time
+	probing   bool
+}
+
+func NewCircuitBreaker(settings BreakerSettings) *CircuitBreaker {
+	return &CircuitBreaker{settings: settings, state: BreakerClosed}
+}
+
+// Allow reports whether a call may go through. Every allowed call must be
+// followed by a Record of its outcome, or a Release.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.settings.CoolDown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.successes++
+			if b.successes >= b.settings.SuccessThreshold {
+				b.state = BreakerClosed
+			}
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends an allowed call without recording its outcome, such as a call
+// abandoned by its caller, which says nothing of the upstream health.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// Reset closes the breaker and forgets the failures counted so far, such as
+// when the upstream moved to another address.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.successes = 0
+	b.probing = false
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		status.OpenedAt = b.openedAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// BreakerGateway short-circuits a Gateway whose upstream keeps failing.
+type BreakerGateway struct {
+	name    string
+	gateway Gateway
+	breaker *CircuitBreaker
+}
+
+func NewBreakerGateway(name string, gateway Gateway, settings BreakerSettings) *BreakerGateway {
+	return &BreakerGateway{
+		name:    name,
+		gateway: gateway,
+		breaker: NewCircuitBreaker(settings),
+	}
+}
+
+func (g *BreakerGateway) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	if !g.breaker.Allow() {
+		return &HttpError{http.StatusText(http.StatusServiceUnavailable), g.name + " upstream unavailable"}
+	}
+
+	err := g.gateway.GetResourceAt(ctx, date, resource)
+	if err != nil && ctx.Err() != nil {
+		g.breaker.Release()
+		return err
+	}
+	g.breaker.Record(err == nil || !isUpstreamFailure(err))
+	return err
+}
+
+// Reset closes the breaker of the upstream.
+func (g *BreakerGateway) Reset() {
+	g.breaker.Reset()
+}
+
+// isUpstreamFailure tells apart errors caused by an unhealthy upstream from
+// answers such as a missing day, which must not open the breaker.
+func isUpstreamFailure(err *HttpError) bool {
+	switch err.Type {
+	case http.StatusText(http.StatusInternalServerError),
+		http.StatusText(http.StatusBadGateway),
+		http.StatusText(http.StatusServiceUnavailable),
+		http.StatusText(http.StatusGatewayTimeout):
+		return true
+	}
+	return false
+}
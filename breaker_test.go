@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type BreakerTestSuite struct {
+	suite.Suite
+	upstream *failingGatewayMock
+	gateway  *BreakerGateway
+}
+
+func TestBreakerTestSuite(t *testing.T) {
+	suite.Run(t, new(BreakerTestSuite))
+}
+
+func (suite *BreakerTestSuite) SetupTest() {
+	suite.upstream = &failingGatewayMock{
+		err: &HttpError{http.StatusText(http.StatusBadGateway), "Upstream is down"},
+	}
+	suite.gateway = NewBreakerGateway("temperature", suite.upstream, BreakerSettings{
+		FailureThreshold: 2,
+		CoolDown:         time.Millisecond * 20,
+		SuccessThreshold: 1,
+	})
+}
+
+func (suite *BreakerTestSuite) TestBreakerShouldOpenAfterConsecutiveFailures() {
+	// Given
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// When
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.DeepEqual(suite.T(), *err, HttpError{
+		Type:    http.StatusText(http.StatusServiceUnavailable),
+		Message: "temperature upstream unavailable",
+	})
+	assert.Equal(suite.T(), suite.upstream.calls, 2)
+	assert.Equal(suite.T(), suite.gateway.breaker.Status().State, BreakerOpen)
+}
+
+func (suite *BreakerTestSuite) TestBreakerShouldCloseAfterSuccessfulProbe() {
+	// Given
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	time.Sleep(time.Millisecond * 30)
+	suite.upstream.err = nil
+
+	// When
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	assert.Equal(suite.T(), suite.gateway.breaker.Status().State, BreakerClosed)
+}
+
+func (suite *BreakerTestSuite) TestBreakerShouldReopenWhenProbeFails() {
+	// Given
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	time.Sleep(time.Millisecond * 30)
+
+	// When
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.Equal(suite.T(), suite.upstream.calls, 3)
+	assert.Equal(suite.T(), suite.gateway.breaker.Status().State, BreakerOpen)
+}
+
+func (suite *BreakerTestSuite) TestBreakerShouldIgnoreNotFound() {
+	// Given
+	suite.upstream.err = &HttpError{http.StatusText(http.StatusNotFound), "Resource not found"}
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// When
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.Equal(suite.T(), err.Type, http.StatusText(http.StatusNotFound))
+	assert.Equal(suite.T(), suite.gateway.breaker.Status().State, BreakerClosed)
+}
+
+func (suite *BreakerTestSuite) TestBreakerShouldIgnoreCallsAbandonedByTheCaller() {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	suite.upstream.err = &HttpError{http.StatusText(http.StatusGatewayTimeout), "Timed out waiting for the upstream"}
+	var temperature Temperature
+	suite.gateway.GetResourceAt(ctx, "2018-08-01T00:00:00Z", &temperature)
+
+	// When
+	suite.gateway.GetResourceAt(ctx, "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.DeepEqual(suite.T(), suite.gateway.breaker.Status(), BreakerStatus{State: BreakerClosed})
+}
+
+type failingGatewayMock struct {
+	err   *HttpError
+	calls int
+}
+
+func (g *failingGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	g.calls++
+	return g.err
+}
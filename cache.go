@@ -0,0 +1,165 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheSettings bounds the response cache and sets how long entries live.
+type CacheSettings struct {
+	// MaxEntries is the number of entries kept before evicting the least
+	// recently used one.
+	MaxEntries int
+	// TTL is how long a recent day is cached.
+	TTL time.Duration
+	// HistoricalAfter is the age past which a day never changes anymore and
+	// is cached without expiration. Zero applies TTL to every day.
+	HistoricalAfter time.Duration
+	// NotFoundTTL is how long a day missing upstream is remembered.
+	NotFoundTTL time.Duration
+}
+
+func DefaultCacheSettings() CacheSettings {
+	return CacheSettings{
+		MaxEntries:      10000,
+		TTL:             time.Minute * 5,
+		HistoricalAfter: time.Hour * 24 * 2,
+		NotFoundTTL:     time.Minute,
+	}
+}
+
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+type cacheKey struct {
+	upstream string
+	date     string
+}
+
+type cacheEntry struct {
+	key       cacheKey
+	body      []byte
+	err       *HttpError
+	expiresAt time.Time
+}
+
+// ResponseCache is a bounded LRU of upstream answers shared by every
+// CachingGateway.
+type ResponseCache struct {
+	mu       sync.Mutex
+	settings CacheSettings
+	entries  map[cacheKey]*list.Element
+	order    *list.List
+	hits     int64
+	misses   int64
+}
+
+func NewResponseCache(settings CacheSettings) *ResponseCache {
+	return &ResponseCache{
+		settings: settings,
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *ResponseCache) get(key cacheKey) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt) {
+			c.order.MoveToFront(element)
+			c.hits++
+			return *entry, true
+		}
+		c.remove(element)
+	}
+	c.misses++
+	return cacheEntry{}, false
+}
+
+func (c *ResponseCache) add(entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+	c.entries[entry.key] = c.order.PushFront(&entry)
+	for c.settings.MaxEntries > 0 && c.order.Len() > c.settings.MaxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *ResponseCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// expiration returns when the answer for the given date goes stale, or the
+// zero time when it never does.
+func (c *ResponseCache) expiration(date string) time.Time {
+	at, err := time.Parse(dateLayout, date)
+	if err == nil && c.settings.HistoricalAfter > 0 && time.Since(at) > c.settings.HistoricalAfter {
+		return time.Time{}
+	}
+	return time.Now().Add(c.settings.TTL)
+}
+
+func (c *ResponseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.order.Len()}
+}
+
+// CachingGateway serves repeated lookups of an upstream from a ResponseCache.
+// Days missing upstream are cached too, for a shorter time.
+type CachingGateway struct {
+	upstream string
+	gateway  Gateway
+	cache    *ResponseCache
+}
+
+func NewCachingGateway(upstream string, gateway Gateway, cache *ResponseCache) *CachingGateway {
+	return &CachingGateway{
+		upstream: upstream,
+		gateway:  gateway,
+		cache:    cache,
+	}
+}
+
+func (g *CachingGateway) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	key := cacheKey{g.upstream, date}
+	if entry, ok := g.cache.get(key); ok {
+		if entry.err != nil {
+			err := *entry.err
+			return &err
+		}
+		if err := json.Unmarshal(entry.body, resource); err == nil {
+			return nil
+		}
+	}
+
+	if err := g.gateway.GetResourceAt(ctx, date, resource); err != nil {
+		if err.Type == http.StatusText(http.StatusNotFound) {
+			notFound := *err
+			g.cache.add(cacheEntry{key: key, err: &notFound, expiresAt: time.Now().Add(g.cache.settings.NotFoundTTL)})
+		}
+		return err
+	}
+
+	if body, err := json.Marshal(resource); err == nil {
+		g.cache.add(cacheEntry{key: key, body: body, expiresAt: g.cache.expiration(date)})
+	}
+	return nil
+}
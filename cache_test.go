@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type CacheTestSuite struct {
+	suite.Suite
+	upstream *countingGatewayMock
+	cache    *ResponseCache
+	gateway  *CachingGateway
+}
+
+func TestCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheTestSuite))
+}
+
+func (suite *CacheTestSuite) SetupTest() {
+	suite.upstream = &countingGatewayMock{
+		gateway: &TemperatureGatewayMock{
+			temperatures: map[string]Temperature{
+				"2018-08-01T00:00:00Z": {Temp: 10.5353456000000, Date: "2018-08-01T00:00:00Z"},
+				"2018-08-02T00:00:00Z": {Temp: 13.5353456555445, Date: "2018-08-02T00:00:00Z"},
+			},
+		},
+	}
+	suite.cache = NewResponseCache(CacheSettings{
+		MaxEntries:      2,
+		TTL:             time.Millisecond * 10,
+		HistoricalAfter: time.Hour * 48,
+		NotFoundTTL:     time.Minute,
+	})
+	suite.gateway = NewCachingGateway("temperature", suite.upstream, suite.cache)
+}
+
+func (suite *CacheTestSuite) TestCacheShouldServeRepeatedLookupsWithoutCallingUpstream() {
+	// Given
+	var first, second Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &first)
+
+	// When
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &second)
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	assert.DeepEqual(suite.T(), second, first)
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(1))
+	assert.DeepEqual(suite.T(), suite.cache.Stats(), CacheStats{Hits: 1, Misses: 1, Entries: 1})
+}
+
+func (suite *CacheTestSuite) TestCacheShouldRememberMissingDays() {
+	// Given
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-03T00:00:00Z", &temperature)
+
+	// When
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-03T00:00:00Z", &temperature)
+
+	// Then
+	assert.Equal(suite.T(), err.Type, http.StatusText(http.StatusNotFound))
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(1))
+}
+
+func (suite *CacheTestSuite) TestCacheShouldEvictLeastRecentlyUsedEntry() {
+	// Given
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-02T00:00:00Z", &temperature)
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-03T00:00:00Z", &temperature)
+
+	// When
+	suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(4))
+	assert.Equal(suite.T(), suite.cache.Stats().Entries, 2)
+}
+
+func (suite *CacheTestSuite) TestCacheShouldExpireRecentDays() {
+	// Given
+	today := time.Now().Truncate(24 * time.Hour).Format(dateLayout)
+	suite.upstream.gateway = &TemperatureGatewayMock{
+		temperatures: map[string]Temperature{today: {Temp: 21, Date: today}},
+	}
+	var temperature Temperature
+	suite.gateway.GetResourceAt(context.Background(), today, &temperature)
+	time.Sleep(time.Millisecond * 20)
+
+	// When
+	suite.gateway.GetResourceAt(context.Background(), today, &temperature)
+
+	// Then
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(2))
+}
+
+type countingGatewayMock struct {
+	gateway Gateway
+	calls   int32
+}
+
+func (g *countingGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	atomic.AddInt32(&g.calls, 1)
+	return g.gateway.GetResourceAt(ctx, date, resource)
+}
+
+func (g *countingGatewayMock) Calls() int32 {
+	return atomic.LoadInt32(&g.calls)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+type CoalescingStats struct {
+	Calls     int64 `json:"calls"`
+	Coalesced int64 `json:"coalesced"`
+}
+
+type inflightCall struct {
+	done    chan struct{}
+	body    json.RawMessage
+	err     *HttpError
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// CoalescingGateway shares a single upstream lookup between concurrent
+// requests for the same date. Every waiting caller gets the answer, or the
+// error, of the lookup already in flight. A caller whose context is done
+// stops waiting, and the lookup is only canceled once every caller did.
+type CoalescingGateway struct {
+	gateway Gateway
+
+	mu        sync.Mutex
+	inflight  map[string]*inflightCall
+	calls     int64
+	coalesced int64
+}
+
+func NewCoalescingGateway(gateway Gateway) *CoalescingGateway {
+	return &CoalescingGateway{
+		gateway:  gateway,
+		inflight: make(map[string]*inflightCall),
+	}
+}
+
+func (g *CoalescingGateway) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	if ctx.Err() != nil {
+		return contextError(ctx.Err())
+	}
+
+	g.mu.Lock()
+	call, ok := g.inflight[date]
+	if ok {
+		g.coalesced++
+	} else {
+		// The lookup keeps the values of the first caller, such as its span,
+		// but outlives it as long as other callers wait.
+		lookupCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &inflightCall{done: make(chan struct{}), cancel: cancel}
+		g.inflight[date] = call
+		g.calls++
+		go g.lookup(lookupCtx, date, call)
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		g.leave(date, call)
+		return contextError(ctx.Err())
+	}
+
+	if call.err != nil {
+		err := *call.err
+		return &err
+	}
+	if err := json.Unmarshal(call.body, resource); err != nil {
+		return &HttpError{http.StatusText(http.StatusInternalServerError), "Failed to unmarshal resource response."}
+	}
+	return nil
+}
+
+func (g *CoalescingGateway) lookup(ctx context.Context, date string, call *inflightCall) {
+	call.err = g.gateway.GetResourceAt(ctx, date, &call.body)
+
+	g.mu.Lock()
+	if g.inflight[date] == call {
+		delete(g.inflight, date)
+	}
+	g.mu.Unlock()
+	call.cancel()
+	close(call.done)
+}
+
+// leave stops a caller from waiting for call, canceling the lookup when no
+// caller is left. Later callers then start a lookup of their own.
+func (g *CoalescingGateway) leave(date string, call *inflightCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if g.inflight[date] == call {
+			delete(g.inflight, date)
+		}
+	}
+}
+
+func (g *CoalescingGateway) Stats() CoalescingStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return CoalescingStats{Calls: g.calls, Coalesced: g.coalesced}
+}
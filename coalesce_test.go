@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type CoalescingTestSuite struct {
+	suite.Suite
+	upstream *blockingGatewayMock
+	gateway  *CoalescingGateway
+}
+
+func TestCoalescingTestSuite(t *testing.T) {
+	suite.Run(t, new(CoalescingTestSuite))
+}
+
+func (suite *CoalescingTestSuite) SetupTest() {
+	suite.upstream = &blockingGatewayMock{
+		release: make(chan struct{}),
+		countingGatewayMock: countingGatewayMock{
+			gateway: &TemperatureGatewayMock{
+				temperatures: map[string]Temperature{
+					"2018-08-01T00:00:00Z": {Temp: 10.5353456000000, Date: "2018-08-01T00:00:00Z"},
+				},
+			},
+		},
+	}
+	suite.gateway = NewCoalescingGateway(suite.upstream)
+}
+
+func (suite *CoalescingTestSuite) TestLookupShouldNotStartOnceCanceled() {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var temperature Temperature
+
+	// When
+	err := suite.gateway.GetResourceAt(ctx, "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.DeepEqual(suite.T(), *err, HttpError{clientClosedRequest, "Request canceled by the client"})
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(0))
+	assert.DeepEqual(suite.T(), suite.gateway.Stats(), CoalescingStats{})
+}
+
+func (suite *CoalescingTestSuite) TestConcurrentLookupsShouldShareOneUpstreamCall() {
+	// Given
+	var wg sync.WaitGroup
+	temperatures := make([]Temperature, 5)
+	errs := make([]*HttpError, 5)
+
+	// When
+	for i := range temperatures {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperatures[i])
+		}(i)
+	}
+	suite.waitForCoalesced(4)
+	close(suite.upstream.release)
+	wg.Wait()
+
+	// Then
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(1))
+	assert.DeepEqual(suite.T(), suite.gateway.Stats(), CoalescingStats{Calls: 1, Coalesced: 4})
+	for i := range temperatures {
+		assert.Assert(suite.T(), errs[i] == nil)
+		assert.DeepEqual(suite.T(), temperatures[i], Temperature{Temp: 10.5353456000000, Date: "2018-08-01T00:00:00Z"})
+	}
+}
+
+func (suite *CoalescingTestSuite) TestConcurrentLookupsShouldShareTheUpstreamError() {
+	// Given
+	var wg sync.WaitGroup
+	errs := make([]*HttpError, 3)
+
+	// When
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var temperature Temperature
+			errs[i] = suite.gateway.GetResourceAt(context.Background(), "2018-08-03T00:00:00Z", &temperature)
+		}(i)
+	}
+	suite.waitForCoalesced(2)
+	close(suite.upstream.release)
+	wg.Wait()
+
+	// Then
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(1))
+	for i := range errs {
+		assert.Equal(suite.T(), errs[i].Type, http.StatusText(http.StatusNotFound))
+	}
+}
+
+func (suite *CoalescingTestSuite) TestCanceledCallerShouldNotFailTheOthers() {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan *HttpError)
+	go func() {
+		var temperature Temperature
+		canceled <- suite.gateway.GetResourceAt(ctx, "2018-08-01T00:00:00Z", &temperature)
+	}()
+	var temperature Temperature
+	waiting := make(chan *HttpError)
+	go func() {
+		waiting <- suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+	}()
+	suite.waitForCoalesced(1)
+
+	// When
+	cancel()
+	canceledErr := <-canceled
+	close(suite.upstream.release)
+	waitingErr := <-waiting
+
+	// Then
+	assert.Equal(suite.T(), canceledErr.Type, clientClosedRequest)
+	assert.Assert(suite.T(), waitingErr == nil)
+	assert.DeepEqual(suite.T(), temperature, Temperature{Temp: 10.5353456000000, Date: "2018-08-01T00:00:00Z"})
+}
+
+func (suite *CoalescingTestSuite) TestLookupShouldBeCanceledWhenEveryCallerLeft() {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan *HttpError)
+	for i := 0; i < 2; i++ {
+		go func() {
+			var temperature Temperature
+			errs <- suite.gateway.GetResourceAt(ctx, "2018-08-01T00:00:00Z", &temperature)
+		}()
+	}
+	suite.waitForCoalesced(1)
+
+	// When
+	cancel()
+	<-errs
+	<-errs
+	close(suite.upstream.release)
+	var temperature Temperature
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temperature)
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	assert.DeepEqual(suite.T(), suite.gateway.Stats(), CoalescingStats{Calls: 2, Coalesced: 1})
+}
+
+func (suite *CoalescingTestSuite) waitForCoalesced(coalesced int64) {
+	for suite.gateway.Stats().Coalesced < coalesced {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type blockingGatewayMock struct {
+	countingGatewayMock
+	release chan struct{}
+}
+
+func (g *blockingGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+	return g.countingGatewayMock.GetResourceAt(ctx, date, resource)
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of the service. Every setting is read, by
+// increasing precedence, from its default, the YAML file given with -config
+// or CONFIG_FILE, its environment variable, the env file given with
+// -env-file or ENV_FILE and its command line flag.
+type Config struct {
+	Listen     string `yaml:"listen"`
+	LogLevel   string `yaml:"log_level"`
+	AdminToken string `yaml:"admin_token"`
+	// ShutdownGrace is how long the requests in flight are waited for when
+	// shutting down.
+	ShutdownGrace Duration `yaml:"shutdown_grace"`
+	// StorePath is the BoltDB file observations are persisted in. Without
+	// it nothing is persisted.
+	StorePath   string         `yaml:"store_path"`
+	Temperature UpstreamConfig `yaml:"temperature"`
+	Windspeed   UpstreamConfig `yaml:"windspeed"`
+	Upstream    HttpConfig     `yaml:"upstream"`
+	Pool        PoolConfig     `yaml:"pool"`
+	Ranges      RangesConfig   `yaml:"ranges"`
+	Breaker     BreakerConfig  `yaml:"breaker"`
+	Cache       CacheConfig    `yaml:"cache"`
+	Live        LiveConfig     `yaml:"live"`
+	Tracing     TracingConfig  `yaml:"tracing"`
+	Alerts      AlertsConfig   `yaml:"alerts"`
+}
+
+// UpstreamConfig locates an upstream and names the unit it reports in. The
+// service is only ready while its required upstreams answer.
+type UpstreamConfig struct {
+	BaseURL  string `yaml:"base_url"`
+	Unit     string `yaml:"unit"`
+	Required bool   `yaml:"required"`
+}
+
+// HttpConfig bounds the requests made to the upstreams.
+type HttpConfig struct {
+	Timeout         Duration `yaml:"timeout"`
+	MaxConnsPerHost int      `yaml:"max_conns_per_host"`
+}
+
+// PoolConfig bounds how many days are looked up at once.
+type PoolConfig struct {
+	PerRequest   int      `yaml:"per_request"`
+	Global       int      `yaml:"global"`
+	QueueTimeout Duration `yaml:"queue_timeout"`
+}
+
+// RangesConfig bounds the ranges accepted by the range endpoints.
+type RangesConfig struct {
+	MaxSpan   Duration `yaml:"max_span"`
+	MaxPoints int      `yaml:"max_points"`
+	MaxLimit  int      `yaml:"max_limit"`
+}
+
+// BreakerConfig tunes the circuit breaker of each upstream.
+type BreakerConfig struct {
+	FailureThreshold int      `yaml:"failure_threshold"`
+	CoolDown         Duration `yaml:"cool_down"`
+	SuccessThreshold int      `yaml:"success_threshold"`
+}
+
+// CacheConfig bounds the response cache. Days older than HistoricalAfter
+// are cached without expiration, unless it is zero.
+type CacheConfig struct {
+	MaxEntries      int      `yaml:"max_entries"`
+	TTL             Duration `yaml:"ttl"`
+	HistoricalAfter Duration `yaml:"historical_after"`
+	NotFoundTTL     Duration `yaml:"not_found_ttl"`
+}
+
+// LiveConfig paces the polling of the current weather streamed to the
+// subscribers.
+type LiveConfig struct {
+	Interval Duration `yaml:"interval"`
+}
+
+// TracingConfig picks where spans are exported: otlp sends them over
+// OTLP/HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables, and
+// stdout prints them. Tracing is disabled without an exporter.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter"`
+}
+
+// AlertsConfig locates the alert rules loaded at startup and keys the
+// signature of their webhook payloads. Alerts are disabled without a secret.
+// Webhooks resolving to a loopback, link-local or private address are only
+// accepted when their host is listed in WebhookHosts.
+type AlertsConfig struct {
+	Path         string   `yaml:"path"`
+	Secret       string   `yaml:"secret"`
+	WebhookHosts []string `yaml:"webhook_hosts"`
+}
+
+// Duration is a time.Duration written as in Go, eg. 10s or 1m30s.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return d.Set(value)
+}
+
+func (d *Duration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func DefaultConfig() Config {
+	httpSettings := DefaultHttpSettings()
+	poolSettings := DefaultPoolSettings()
+	rangeSettings := DefaultRangeSettings()
+	breakerSettings := DefaultBreakerSettings()
+	cacheSettings := DefaultCacheSettings()
+	liveSettings := DefaultLiveSettings()
+	return Config{
+		Listen:        ":8080",
+		LogLevel:      zerolog.DebugLevel.String(),
+		ShutdownGrace: Duration(time.Second * 10),
+		Temperature:   UpstreamConfig{Unit: celsius, Required: true},
+		Windspeed:     UpstreamConfig{Unit: metersPerSecond, Required: true},
+		Upstream: HttpConfig{
+			Timeout:         Duration(httpSettings.Timeout),
+			MaxConnsPerHost: httpSettings.MaxConnsPerHost,
+		},
+		Pool: PoolConfig{
+			PerRequest:   poolSettings.PerRequest,
+			Global:       poolSettings.Global,
+			QueueTimeout: Duration(poolSettings.QueueTimeout),
+		},
+		Ranges: RangesConfig{
+			MaxSpan:   Duration(rangeSettings.MaxSpan),
+			MaxPoints: rangeSettings.MaxPoints,
+			MaxLimit:  rangeSettings.MaxLimit,
+		},
+		Breaker: BreakerConfig{
+			FailureThreshold: breakerSettings.FailureThreshold,
+			CoolDown:         Duration(breakerSettings.CoolDown),
+			SuccessThreshold: breakerSettings.SuccessThreshold,
+		},
+		Cache: CacheConfig{
+			MaxEntries:      cacheSettings.MaxEntries,
+			TTL:             Duration(cacheSettings.TTL),
+			HistoricalAfter: Duration(cacheSettings.HistoricalAfter),
+			NotFoundTTL:     Duration(cacheSettings.NotFoundTTL),
+		},
+		Live: LiveConfig{Interval: Duration(liveSettings.Interval)},
+	}
+}
+
+// configSetting is a setting that can be overridden by an environment
+// variable and a flag.
+type configSetting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+var configSettings = []configSetting{
+	{"listen", "PORT", "port to listen on, as :<PORT>", func(c *Config, v string) error { c.Listen = ":" + v; return nil }},
+	{"listen", "LISTEN_ADDRESS", "address to listen on, eg. :8080", stringSetting(func(c *Config) *string { return &c.Listen })},
+	{"log-level", "LOG_LEVEL", "minimum level logged, among trace, debug, info, warn, error", stringSetting(func(c *Config) *string { return &c.LogLevel })},
+	{"admin-token", "ADMIN_TOKEN", "bearer token of the admin calls such as POST /admin/reload", stringSetting(func(c *Config) *string { return &c.AdminToken })},
+	{"shutdown-grace", "SHUTDOWN_GRACE", "time the requests in flight are waited for when shutting down, eg. 10s", durationSetting(func(c *Config) *Duration { return &c.ShutdownGrace })},
+	{"store-path", "STORE_PATH", "BoltDB file the observations are persisted in, nothing is persisted without it", stringSetting(func(c *Config) *string { return &c.StorePath })},
+	{"temperature-url", "TEMPERATURE_BASE_URL", "base URL of the temperature upstream", stringSetting(func(c *Config) *string { return &c.Temperature.BaseURL })},
+	{"temperature-unit", "TEMPERATURE_UNIT", "unit of the temperature upstream, among C, F, K", stringSetting(func(c *Config) *string { return &c.Temperature.Unit })},
+	{"temperature-required", "TEMPERATURE_REQUIRED", "whether the service is unready while the temperature upstream is down", boolSetting(func(c *Config) *bool { return &c.Temperature.Required })},
+	{"windspeed-url", "WINDSPEED_BASE_URL", "base URL of the windspeed upstream", stringSetting(func(c *Config) *string { return &c.Windspeed.BaseURL })},
+	{"windspeed-unit", "WINDSPEED_UNIT", "unit of the windspeed upstream, among m/s, km/h, mph, kn", stringSetting(func(c *Config) *string { return &c.Windspeed.Unit })},
+	{"windspeed-required", "WINDSPEED_REQUIRED", "whether the service is unready while the windspeed upstream is down", boolSetting(func(c *Config) *bool { return &c.Windspeed.Required })},
+	{"upstream-timeout", "UPSTREAM_TIMEOUT", "timeout of each upstream request, eg. 10s", durationSetting(func(c *Config) *Duration { return &c.Upstream.Timeout })},
+	{"upstream-max-conns", "UPSTREAM_MAX_CONNS_PER_HOST", "connections opened at most to each upstream", intSetting(func(c *Config) *int { return &c.Upstream.MaxConnsPerHost })},
+	{"pool-per-request", "POOL_PER_REQUEST", "days a single request looks up at once", intSetting(func(c *Config) *int { return &c.Pool.PerRequest })},
+	{"pool-global", "POOL_GLOBAL", "days looked up at once across every request", intSetting(func(c *Config) *int { return &c.Pool.Global })},
+	{"pool-queue-timeout", "POOL_QUEUE_TIMEOUT", "time a request waits for the pool before being rejected, eg. 2s", durationSetting(func(c *Config) *Duration { return &c.Pool.QueueTimeout })},
+	{"ranges-max-span", "RANGES_MAX_SPAN", "longest range between start and end, eg. 8784h", durationSetting(func(c *Config) *Duration { return &c.Ranges.MaxSpan })},
+	{"ranges-max-points", "RANGES_MAX_POINTS", "points answered at most by a range request without limit", intSetting(func(c *Config) *int { return &c.Ranges.MaxPoints })},
+	{"ranges-max-limit", "RANGES_MAX_LIMIT", "largest limit a range request may ask for", intSetting(func(c *Config) *int { return &c.Ranges.MaxLimit })},
+	{"breaker-failure-threshold", "BREAKER_FAILURE_THRESHOLD", "consecutive upstream failures opening its circuit breaker", intSetting(func(c *Config) *int { return &c.Breaker.FailureThreshold })},
+	{"breaker-cool-down", "BREAKER_COOL_DOWN", "time an open circuit breaker waits before letting a probe through, eg. 30s", durationSetting(func(c *Config) *Duration { return &c.Breaker.CoolDown })},
+	{"breaker-success-threshold", "BREAKER_SUCCESS_THRESHOLD", "successful probes closing a circuit breaker again", intSetting(func(c *Config) *int { return &c.Breaker.SuccessThreshold })},
+	{"cache-max-entries", "CACHE_MAX_ENTRIES", "days cached at most, 0 for no limit", intSetting(func(c *Config) *int { return &c.Cache.MaxEntries })},
+	{"cache-ttl", "CACHE_TTL", "time a recent day is cached, eg. 5m", durationSetting(func(c *Config) *Duration { return &c.Cache.TTL })},
+	{"cache-historical-after", "CACHE_HISTORICAL_AFTER", "age past which a day is cached without expiration, 0s to never", durationSetting(func(c *Config) *Duration { return &c.Cache.HistoricalAfter })},
+	{"cache-not-found-ttl", "CACHE_NOT_FOUND_TTL", "time a day missing upstream is remembered, eg. 1m", durationSetting(func(c *Config) *Duration { return &c.Cache.NotFoundTTL })},
+	{"live-interval", "LIVE_INTERVAL", "time between two polls of the current weather streamed, eg. 5s", durationSetting(func(c *Config) *Duration { return &c.Live.Interval })},
+	{"tracing-exporter", "TRACING_EXPORTER", "exporter of the traces among otlp, stdout, tracing is disabled without it", stringSetting(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"alerts-path", "ALERTS_PATH", "YAML file of the alert rules loaded at startup", stringSetting(func(c *Config) *string { return &c.Alerts.Path })},
+	{"alerts-secret", "ALERTS_SECRET", "key signing the webhook payloads, alerts are disabled without it", stringSetting(func(c *Config) *string { return &c.Alerts.Secret })},
+	{"alerts-webhook-hosts", "ALERTS_WEBHOOK_HOSTS", "comma separated webhook hosts allowed to resolve to a private address", listSetting(func(c *Config) *[]string { return &c.Alerts.WebhookHosts })},
+}
+
+func stringSetting(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func listSetting(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func intSetting(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field(c) = number
+		return nil
+	}
+}
+
+func boolSetting(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(c) = enabled
+		return nil
+	}
+}
+
+func durationSetting(field func(*Config) *Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		if err := field(c).Set(value); err != nil {
+			return fmt.Errorf("%q is not a duration such as 10s", value)
+		}
+		return nil
+	}
+}
+
+// LoadConfig reads the configuration from the command line arguments, the
+// files they or the environment point to and the environment, then validates
+// it. Every problem found is reported at once.
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	config := DefaultConfig()
+
+	flags := flag.NewFlagSet("charly-weather", flag.ContinueOnError)
+	path := flags.String("config", "", "path to the YAML configuration file ($CONFIG_FILE)")
+	envPath := flags.String("env-file", "", "path to a file of KEY=VALUE lines overriding the environment ($ENV_FILE)")
+	values := make(map[string]*string)
+	for _, setting := range configSettings {
+		if _, ok := values[setting.flag]; !ok {
+			values[setting.flag] = flags.String(setting.flag, "", setting.usage+" ($"+setting.env+")")
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	if *envPath == "" {
+		*envPath = getenv("ENV_FILE")
+	}
+	if *envPath != "" {
+		values, err := readEnvFile(*envPath)
+		if err != nil {
+			return config, err
+		}
+		getenv = overrideEnv(values, getenv)
+	}
+	if *path == "" {
+		*path = getenv("CONFIG_FILE")
+	}
+	if *path != "" {
+		content, err := ioutil.ReadFile(*path)
+		if err != nil {
+			return config, err
+		}
+		if err := yaml.UnmarshalStrict(content, &config); err != nil {
+			return config, fmt.Errorf("%s: %v", *path, err)
+		}
+	}
+
+	var result error
+	for _, setting := range configSettings {
+		if value := getenv(setting.env); value != "" {
+			if err := setting.set(&config, value); err != nil {
+				result = multierror.Append(result, fmt.Errorf("%s: %v", setting.env, err))
+			}
+		}
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, setting := range configSettings {
+		if set[setting.flag] && setting.env != "PORT" {
+			if err := setting.set(&config, *values[setting.flag]); err != nil {
+				result = multierror.Append(result, fmt.Errorf("-%s: %v", setting.flag, err))
+			}
+		}
+	}
+
+	config.Windspeed.Unit = normalizeWindUnit(config.Windspeed.Unit)
+	if err := config.Validate(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return config, result
+}
+
+// readEnvFile reads the KEY=VALUE lines of an env file, as written for
+// docker. Blank lines and lines starting with # are skipped and values may
+// be quoted.
+func readEnvFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		value := strings.TrimSpace(parts[1])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(parts[0])] = value
+	}
+	return values, nil
+}
+
+// overrideEnv looks variables up in values before the environment.
+func overrideEnv(values map[string]string, getenv func(string) string) func(string) string {
+	return func(key string) string {
+		if value, ok := values[key]; ok {
+			return value
+		}
+		return getenv(key)
+	}
+}
+
+// Validate reports every invalid setting of the configuration.
+func (c Config) Validate() error {
+	var result error
+	fail := func(format string, args ...interface{}) {
+		result = multierror.Append(result, fmt.Errorf(format, args...))
+	}
+
+	if c.Listen == "" {
+		fail("listen: an address to listen on is required")
+	}
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil || c.LogLevel == "" {
+		fail("log_level: %q is not among trace, debug, info, warn, error, fatal, panic", c.LogLevel)
+	}
+	if c.ShutdownGrace <= 0 {
+		fail("shutdown_grace: must be positive")
+	}
+	for name, upstream := range map[string]UpstreamConfig{temperatureUpstream: c.Temperature, windspeedUpstream: c.Windspeed} {
+		if upstream.BaseURL == "" {
+			fail("%s.base_url: the %s upstream base URL is required", name, name)
+		} else if baseURL, err := url.Parse(upstream.BaseURL); err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+			fail("%s.base_url: %q is not an http or https URL", name, upstream.BaseURL)
+		}
+	}
+	if !isTemperatureUnit(c.Temperature.Unit) {
+		fail("temperature.unit: %q is not among C, F, K", c.Temperature.Unit)
+	}
+	if _, ok := windFactors[c.Windspeed.Unit]; !ok {
+		fail("windspeed.unit: %q is not among m/s, km/h, mph, kn", c.Windspeed.Unit)
+	}
+	if c.Upstream.Timeout <= 0 {
+		fail("upstream.timeout: must be positive")
+	}
+	if c.Upstream.MaxConnsPerHost <= 0 {
+		fail("upstream.max_conns_per_host: must be positive")
+	}
+	if c.Pool.PerRequest <= 0 {
+		fail("pool.per_request: must be positive")
+	}
+	if c.Pool.Global < c.Pool.PerRequest {
+		fail("pool.global: must be at least pool.per_request")
+	}
+	if c.Pool.QueueTimeout <= 0 {
+		fail("pool.queue_timeout: must be positive")
+	}
+	if c.Ranges.MaxSpan < Duration(24*time.Hour) {
+		fail("ranges.max_span: must be at least a day")
+	}
+	if c.Ranges.MaxPoints <= 0 {
+		fail("ranges.max_points: must be positive")
+	}
+	if c.Ranges.MaxLimit <= 0 {
+		fail("ranges.max_limit: must be positive")
+	}
+	if c.Breaker.FailureThreshold <= 0 {
+		fail("breaker.failure_threshold: must be positive")
+	}
+	if c.Breaker.CoolDown <= 0 {
+		fail("breaker.cool_down: must be positive")
+	}
+	if c.Breaker.SuccessThreshold <= 0 {
+		fail("breaker.success_threshold: must be positive")
+	}
+	if c.Cache.MaxEntries < 0 {
+		fail("cache.max_entries: must not be negative")
+	}
+	if c.Cache.TTL <= 0 {
+		fail("cache.ttl: must be positive")
+	}
+	if c.Cache.HistoricalAfter < 0 {
+		fail("cache.historical_after: must not be negative")
+	}
+	if c.Cache.NotFoundTTL < 0 {
+		fail("cache.not_found_ttl: must not be negative")
+	}
+	if c.Live.Interval <= 0 {
+		fail("live.interval: must be positive")
+	}
+	if !isTracingExporter(c.Tracing.Exporter) {
+		fail("tracing.exporter: %q is not among otlp, stdout", c.Tracing.Exporter)
+	}
+	if c.Alerts.Path != "" && c.Alerts.Secret == "" {
+		fail("alerts.secret: a secret is required to deliver the rules of alerts.path")
+	}
+	return result
+}
+
+func (c Config) HttpSettings() HttpSettings {
+	return HttpSettings{Timeout: time.Duration(c.Upstream.Timeout), MaxConnsPerHost: c.Upstream.MaxConnsPerHost}
+}
+
+func (c Config) PoolSettings() PoolSettings {
+	return PoolSettings{PerRequest: c.Pool.PerRequest, Global: c.Pool.Global, QueueTimeout: time.Duration(c.Pool.QueueTimeout)}
+}
+
+func (c Config) RangeSettings() RangeSettings {
+	return RangeSettings{MaxSpan: time.Duration(c.Ranges.MaxSpan), MaxPoints: c.Ranges.MaxPoints, MaxLimit: c.Ranges.MaxLimit}
+}
+
+func (c Config) BreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		FailureThreshold: c.Breaker.FailureThreshold,
+		CoolDown:         time.Duration(c.Breaker.CoolDown),
+		SuccessThreshold: c.Breaker.SuccessThreshold,
+	}
+}
+
+func (c Config) CacheSettings() CacheSettings {
+	return CacheSettings{
+		MaxEntries:      c.Cache.MaxEntries,
+		TTL:             time.Duration(c.Cache.TTL),
+		HistoricalAfter: time.Duration(c.Cache.HistoricalAfter),
+		NotFoundTTL:     time.Duration(c.Cache.NotFoundTTL),
+	}
+}
+
+func (c Config) LiveSettings() LiveSettings {
+	settings := DefaultLiveSettings()
+	settings.Interval = time.Duration(c.Live.Interval)
+	return settings
+}
+
+func (c Config) AlertSettings() AlertSettings {
+	settings := DefaultAlertSettings()
+	settings.Secret = c.Alerts.Secret
+	settings.WebhookHosts = c.Alerts.WebhookHosts
+	return settings
+}
+
+// Level is the minimum level logged, debug when invalid.
+func (c Config) Level() zerolog.Level {
+	level, err := zerolog.ParseLevel(c.LogLevel)
+	if err != nil || c.LogLevel == "" {
+		return zerolog.DebugLevel
+	}
+	return level
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+	env map[string]string
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
+
+func (suite *ConfigTestSuite) SetupTest() {
+	suite.env = map[string]string{
+		"TEMPERATURE_BASE_URL": "http://temperature:8000",
+		"WINDSPEED_BASE_URL":   "http://windspeed:8080",
+	}
+}
+
+func (suite *ConfigTestSuite) getenv(key string) string {
+	return suite.env[key]
+}
+
+func (suite *ConfigTestSuite) writeFile(content string) string {
+	path := filepath.Join(suite.T().TempDir(), "config.yml")
+	assert.NilError(suite.T(), ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldApplyDefaults() {
+	// When
+	config, err := LoadConfig(nil, suite.getenv)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), config.Listen, ":8080")
+	assert.Equal(suite.T(), config.Temperature.Unit, celsius)
+	assert.Equal(suite.T(), config.HttpSettings(), DefaultHttpSettings())
+	assert.Equal(suite.T(), config.PoolSettings(), DefaultPoolSettings())
+	assert.Equal(suite.T(), config.RangeSettings(), DefaultRangeSettings())
+	assert.Equal(suite.T(), config.BreakerSettings(), DefaultBreakerSettings())
+	assert.Equal(suite.T(), config.CacheSettings(), DefaultCacheSettings())
+	assert.Equal(suite.T(), config.LiveSettings(), DefaultLiveSettings())
+	assert.Assert(suite.T(), newTracerProvider(config.Tracing, zerolog.Nop()) == nil)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldOverrideFileWithEnvAndEnvWithFlags() {
+	// Given
+	suite.env["CONFIG_FILE"] = suite.writeFile(`
+listen: ":9000"
+log_level: info
+temperature:
+  base_url: http://file-temperature
+  unit: F
+upstream:
+  timeout: 3s
+pool:
+  per_request: 4
+  global: 8
+ranges:
+  max_points: 500
+breaker:
+  cool_down: 1m
+`)
+	suite.env["TEMPERATURE_BASE_URL"] = ""
+	suite.env["UPSTREAM_TIMEOUT"] = "5s"
+	suite.env["POOL_GLOBAL"] = "12"
+	suite.env["WINDSPEED_UNIT"] = "kmh"
+	suite.env["ALERTS_WEBHOOK_HOSTS"] = "hooks.internal, localhost"
+	suite.env["LIVE_INTERVAL"] = "5s"
+	suite.env["TRACING_EXPORTER"] = "otlp"
+	suite.env["RANGES_MAX_POINTS"] = "2000"
+	suite.env["CACHE_MAX_ENTRIES"] = "100"
+
+	// When
+	config, err := LoadConfig([]string{"-upstream-timeout", "7s", "-log-level", "warn", "-tracing-exporter", "stdout"}, suite.getenv)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), config.Listen, ":9000")
+	assert.Equal(suite.T(), config.LogLevel, "warn")
+	assert.Equal(suite.T(), config.Temperature, UpstreamConfig{BaseURL: "http://file-temperature", Unit: fahrenheit, Required: true})
+	assert.Equal(suite.T(), config.Windspeed, UpstreamConfig{BaseURL: "http://windspeed:8080", Unit: kilometersPerHour, Required: true})
+	assert.Equal(suite.T(), time.Duration(config.Upstream.Timeout), time.Second*7)
+	assert.Equal(suite.T(), config.Pool.PerRequest, 4)
+	assert.Equal(suite.T(), config.Pool.Global, 12)
+	assert.DeepEqual(suite.T(), config.Alerts.WebhookHosts, []string{"hooks.internal", "localhost"})
+	assert.Equal(suite.T(), config.LiveSettings().Interval, time.Second*5)
+	assert.Equal(suite.T(), config.Tracing.Exporter, "stdout")
+	assert.Equal(suite.T(), config.RangeSettings().MaxPoints, 2000)
+	assert.Equal(suite.T(), config.BreakerSettings().CoolDown, time.Minute)
+	assert.Equal(suite.T(), config.CacheSettings().MaxEntries, 100)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldReadFileFromFlag() {
+	// Given
+	path := suite.writeFile("listen: 127.0.0.1:9000\n")
+	suite.env["PORT"] = "8081"
+
+	// When
+	config, err := LoadConfig([]string{"-config", path, "-listen", ":9001"}, suite.getenv)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), config.Listen, ":9001")
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldListenOnPort() {
+	// Given
+	suite.env["PORT"] = "8081"
+
+	// When
+	config, err := LoadConfig(nil, suite.getenv)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), config.Listen, ":8081")
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldReportEveryInvalidSetting() {
+	// Given
+	suite.env["WINDSPEED_BASE_URL"] = ""
+	suite.env["TEMPERATURE_BASE_URL"] = "temperature:8000"
+	suite.env["TEMPERATURE_UNIT"] = "X"
+	suite.env["LOG_LEVEL"] = "loud"
+	suite.env["ALERTS_PATH"] = "alerts.yml"
+	suite.env["LIVE_INTERVAL"] = "5"
+	suite.env["TRACING_EXPORTER"] = "jaeger"
+	suite.env["RANGES_MAX_SPAN"] = "1h"
+	suite.env["BREAKER_FAILURE_THRESHOLD"] = "0"
+	suite.env["CACHE_TTL"] = "-1m"
+
+	// When
+	_, err := LoadConfig([]string{"-upstream-timeout", "soon", "-pool-global", "0"}, suite.getenv)
+
+	// Then
+	assert.Assert(suite.T(), err != nil)
+	assert.Assert(suite.T(), is.Contains(err.Error(), "windspeed.base_url: the windspeed upstream base URL is required"))
+	assert.Assert(suite.T(), is.Contains(err.Error(), `temperature.base_url: "temperature:8000" is not an http or https URL`))
+	assert.Assert(suite.T(), is.Contains(err.Error(), `temperature.unit: "X" is not among C, F, K`))
+	assert.Assert(suite.T(), is.Contains(err.Error(), `log_level: "loud"`))
+	assert.Assert(suite.T(), is.Contains(err.Error(), `-upstream-timeout: "soon" is not a duration such as 10s`))
+	assert.Assert(suite.T(), is.Contains(err.Error(), "pool.global: must be at least pool.per_request"))
+	assert.Assert(suite.T(), is.Contains(err.Error(), "alerts.secret: a secret is required to deliver the rules of alerts.path"))
+	assert.Assert(suite.T(), is.Contains(err.Error(), `LIVE_INTERVAL: "5" is not a duration such as 10s`))
+	assert.Assert(suite.T(), is.Contains(err.Error(), `tracing.exporter: "jaeger" is not among otlp, stdout`))
+	assert.Assert(suite.T(), is.Contains(err.Error(), "ranges.max_span: must be at least a day"))
+	assert.Assert(suite.T(), is.Contains(err.Error(), "breaker.failure_threshold: must be positive"))
+	assert.Assert(suite.T(), is.Contains(err.Error(), "cache.ttl: must be positive"))
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldRejectUnknownFileSettings() {
+	// Given
+	suite.env["CONFIG_FILE"] = suite.writeFile("upstream:\n  timout: 3s\n")
+
+	// When
+	_, err := LoadConfig(nil, suite.getenv)
+
+	// Then
+	assert.Assert(suite.T(), is.Contains(err.Error(), "field timout not found"))
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldRejectMissingFile() {
+	// When
+	_, err := LoadConfig([]string{"-config", filepath.Join(os.TempDir(), "missing-charly.yml")}, suite.getenv)
+
+	// Then
+	assert.Assert(suite.T(), os.IsNotExist(err))
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldOverrideEnvWithEnvFile() {
+	// Given
+	suite.env["CONFIG_FILE"] = suite.writeFile("windspeed:\n  base_url: http://file-windspeed\n")
+	envFile := filepath.Join(suite.T().TempDir(), "charly.env")
+	assert.NilError(suite.T(), ioutil.WriteFile(envFile, []byte(`
+# Rotated during maintenance
+TEMPERATURE_BASE_URL="http://standby-temperature:8000"
+export UPSTREAM_TIMEOUT=3s
+`), 0600))
+	suite.env["ENV_FILE"] = envFile
+	suite.env["WINDSPEED_BASE_URL"] = ""
+
+	// When
+	config, err := LoadConfig(nil, suite.getenv)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), config.Temperature.BaseURL, "http://standby-temperature:8000")
+	assert.Equal(suite.T(), config.Windspeed.BaseURL, "http://file-windspeed")
+	assert.Equal(suite.T(), time.Duration(config.Upstream.Timeout), time.Second*3)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigShouldAcceptExampleFile() {
+	// When
+	config, err := LoadConfig([]string{"-config", "config.example.yml"}, func(string) string { return "" })
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), config.Listen, ":8081")
+	assert.Assert(suite.T(), config.Temperature.Required)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// WindMetrics are derived from the north and west components of the wind.
+// The components give where the air moves to, while Direction follows the
+// meteorological convention: the bearing the wind blows from, in degrees
+// clockwise from north.
+type WindMetrics struct {
+	Magnitude *float64 `json:"magnitude,omitempty"`
+	Direction *float64 `json:"direction,omitempty"`
+	Compass   string   `json:"compass,omitempty"`
+	Beaufort  *int     `json:"beaufort,omitempty"`
+}
+
+// ComfortMetrics combine the temperature with the wind.
+//
+// WindChill follows the North American and UK formula, only defined at or
+// below 10°C with a wind of at least 4.8 km/h, and is omitted otherwise.
+// Without humidity from the upstreams no heat index can be computed, so
+// ApparentTemp is the wind chill when defined and the air temperature
+// otherwise. Both are omitted when the temperature lies outside of the
+// plausible -90°C to 60°C or the wind is above 120 m/s.
+type ComfortMetrics struct {
+	WindChill    *float64 `json:"wind_chill,omitempty"`
+	ApparentTemp *float64 `json:"apparent_temp,omitempty"`
+}
+
+const (
+	windChillMaxTemp  = 10.0
+	windChillMinSpeed = 4.8 / 3.6
+
+	minPlausibleTemp  = -90.0
+	maxPlausibleTemp  = 60.0
+	maxPlausibleSpeed = 120.0
+
+	// calmSpeed is the wind speed, in m/s, below which the wind has no
+	// direction.
+	calmSpeed = 1e-6
+)
+
+const (
+	magnitudeField = "magnitude"
+	directionField = "direction"
+	compassField   = "compass"
+	beaufortField  = "beaufort"
+
+	windChillField    = "wind_chill"
+	apparentTempField = "apparent_temp"
+)
+
+var derivedWindFields = []string{magnitudeField, directionField, compassField, beaufortField}
+
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// beaufortLimits are the upper wind speeds, in meters per second, of each
+// Beaufort force below 12.
+var beaufortLimits = []float64{0.5, 1.5, 3.3, 5.5, 7.9, 10.7, 13.8, 17.1, 20.7, 24.4, 28.4, 32.6}
+
+// outputOptions are the per request options shaping each observation
+// answered by the range endpoints. Observations are read in the upstream
+// units and answered in units.
+type outputOptions struct {
+	windFields map[string]bool
+	comfort    bool
+	upstream   Units
+	units      Units
+}
+
+// getOutputOptionsFromRequest reads include, where derived adds every
+// derived wind field and comfort the comfort indices, fields, picking some
+// derived wind fields (eg. fields=magnitude,compass), and the units.
+func getOutputOptionsFromRequest(c echo.Context, upstream Units) (outputOptions, *HttpError) {
+	units, err := getUnitsFromRequest(c, upstream)
+	if err != nil {
+		return outputOptions{}, err
+	}
+	options := outputOptions{windFields: make(map[string]bool), upstream: upstream, units: units}
+
+	for _, include := range splitParam(c.QueryParam("include")) {
+		switch include {
+		case "derived":
+			for _, field := range derivedWindFields {
+				options.windFields[field] = true
+			}
+		case "comfort":
+			options.comfort = true
+		default:
+			return options, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide include among derived, comfort"}
+		}
+	}
+
+	for _, field := range splitParam(c.QueryParam("fields")) {
+		if !contains(derivedWindFields, field) {
+			return options, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide fields among " + strings.Join(derivedWindFields, ", ")}
+		}
+		options.windFields[field] = true
+	}
+	return options, nil
+}
+
+// allMetricsOptions computes every derived and comfort metric, keeping the
+// values in the given units.
+func allMetricsOptions(units Units) outputOptions {
+	options := outputOptions{windFields: make(map[string]bool), comfort: true, upstream: units, units: units}
+	for _, field := range derivedWindFields {
+		options.windFields[field] = true
+	}
+	return options
+}
+
+// apply computes the derived metrics of an observation in the canonical
+// units, then converts every value to the requested units.
+func (o outputOptions) apply(observation interface{}) interface{} {
+	switch value := observation.(type) {
+	case Temperature:
+		value.Temp = convertTemperature(value.Temp, o.upstream.Temp, o.units.Temp)
+		return value
+	case Windspeed:
+		north, west := o.canonicalWind(value.North, value.West)
+		value.WindMetrics = o.windMetrics(north, west)
+		value.North, value.West = o.wind(north), o.wind(west)
+		return value
+	case Weather:
+		temp := convertTemperature(value.Temp, o.upstream.Temp, canonicalUnits.Temp)
+		north, west := o.canonicalWind(value.North, value.West)
+		value.WindMetrics = o.windMetrics(north, west)
+		if o.comfort {
+			value.ComfortMetrics = o.comfortMetrics(temp, windMagnitude(north, west))
+		}
+		value.Temp = convertTemperature(temp, canonicalUnits.Temp, o.units.Temp)
+		value.North, value.West = o.wind(north), o.wind(west)
+		return value
+	}
+	return observation
+}
+
+// includes reports whether a field, named after its JSON key, is answered.
+func (o outputOptions) includes(field string) bool {
+	switch {
+	case field == windChillField || field == apparentTempField:
+		return o.comfort
+	case contains(derivedWindFields, field):
+		return o.windFields[field]
+	}
+	return true
+}
+
+func (o outputOptions) canonicalWind(north, west float64) (float64, float64) {
+	return convertWind(north, o.upstream.Wind, canonicalUnits.Wind), convertWind(west, o.upstream.Wind, canonicalUnits.Wind)
+}
+
+// wind converts a canonical wind speed to the requested unit.
+func (o outputOptions) wind(speed float64) float64 {
+	return convertWind(speed, canonicalUnits.Wind, o.units.Wind)
+}
+
+// windMetrics takes the canonical wind components.
+func (o outputOptions) windMetrics(north, west float64) WindMetrics {
+	var metrics WindMetrics
+	if len(o.windFields) == 0 {
+		return metrics
+	}
+
+	magnitude := windMagnitude(north, west)
+	direction := windDirection(north, west)
+	beaufort := beaufortForce(magnitude)
+	if o.windFields[magnitudeField] {
+		speed := o.wind(magnitude)
+		metrics.Magnitude = &speed
+	}
+	calm := magnitude < calmSpeed
+	if o.windFields[directionField] && !calm {
+		metrics.Direction = &direction
+	}
+	if o.windFields[compassField] && !calm {
+		metrics.Compass = compassPoint(direction)
+	}
+	if o.windFields[beaufortField] {
+		metrics.Beaufort = &beaufort
+	}
+	return metrics
+}
+
+// comfortMetrics takes the canonical temperature and wind speed.
+func (o outputOptions) comfortMetrics(temp, speed float64) ComfortMetrics {
+	metrics := comfortMetrics(temp, speed)
+	for _, value := range []*float64{metrics.WindChill, metrics.ApparentTemp} {
+		if value != nil {
+			*value = convertTemperature(*value, canonicalUnits.Temp, o.units.Temp)
+		}
+	}
+	return metrics
+}
+
+func windMagnitude(north, west float64) float64 {
+	return math.Hypot(north, west)
+}
+
+// windDirection returns the bearing the wind blows from. The air moving to
+// the east (-west) and north comes from the opposite bearing.
+func windDirection(north, west float64) float64 {
+	degrees := math.Atan2(west, -north) * 180 / math.Pi
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+func compassPoint(direction float64) string {
+	return compassPoints[int((direction+11.25)/22.5)%len(compassPoints)]
+}
+
+func beaufortForce(speed float64) int {
+	for force, limit := range beaufortLimits {
+		if speed < limit {
+			return force
+		}
+	}
+	return len(beaufortLimits)
+}
+
+func comfortMetrics(temp, speed float64) ComfortMetrics {
+	var metrics ComfortMetrics
+	if temp < minPlausibleTemp || temp > maxPlausibleTemp || speed > maxPlausibleSpeed {
+		return metrics
+	}
+
+	apparent := temp
+	if temp <= windChillMaxTemp && speed >= windChillMinSpeed {
+		chill := windChill(temp, speed)
+		metrics.WindChill = &chill
+		apparent = chill
+	}
+	metrics.ApparentTemp = &apparent
+	return metrics
+}
+
+// windChill takes the temperature in degrees Celsius and the wind in meters
+// per second, which the formula expects in kilometers per hour.
+func windChill(temp, speed float64) float64 {
+	v := math.Pow(speed*3.6, 0.16)
+	return 13.12 + 0.6215*temp - 11.37*v + 0.3965*temp*v
+}
+
+func splitParam(param string) []string {
+	if param == "" {
+		return nil
+	}
+	return strings.Split(param, ",")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type DerivedTestSuite struct {
+	suite.Suite
+}
+
+func TestDerivedTestSuite(t *testing.T) {
+	suite.Run(t, new(DerivedTestSuite))
+}
+
+func (suite *DerivedTestSuite) TestWindDirectionShouldBeWhereTheWindBlowsFrom() {
+	// Air moving north comes from the south, air moving west from the east.
+	assert.Equal(suite.T(), windDirection(1, 0), 180.0)
+	assert.Equal(suite.T(), windDirection(0, 1), 90.0)
+	assert.Equal(suite.T(), windDirection(-1, 0), 0.0)
+	assert.Equal(suite.T(), windDirection(0, -1), 270.0)
+	assert.Equal(suite.T(), windDirection(-1, -1), 315.0)
+}
+
+func (suite *DerivedTestSuite) TestCompassPointShouldRoundToTheClosestPoint() {
+	assert.Equal(suite.T(), compassPoint(0), "N")
+	assert.Equal(suite.T(), compassPoint(11.24), "N")
+	assert.Equal(suite.T(), compassPoint(11.25), "NNE")
+	assert.Equal(suite.T(), compassPoint(225), "SW")
+	assert.Equal(suite.T(), compassPoint(350), "N")
+}
+
+func (suite *DerivedTestSuite) TestBeaufortForceShouldFollowTheScaleInMetersPerSecond() {
+	assert.Equal(suite.T(), beaufortForce(0.2), 0)
+	assert.Equal(suite.T(), beaufortForce(3.3), 3)
+	assert.Equal(suite.T(), beaufortForce(10), 5)
+	assert.Equal(suite.T(), beaufortForce(40), 12)
+}
+
+func (suite *DerivedTestSuite) TestApplyShouldOnlyAddTheSelectedFields() {
+	// Given
+	options := outputOptions{
+		windFields: map[string]bool{magnitudeField: true, compassField: true},
+		upstream:   canonicalUnits,
+		units:      canonicalUnits,
+	}
+
+	// When
+	speed := options.apply(Windspeed{North: 3, West: -4, Date: "2018-08-01T00:00:00Z"}).(Windspeed)
+
+	// Then
+	assert.Equal(suite.T(), *speed.Magnitude, 5.0)
+	assert.Equal(suite.T(), speed.Compass, "SW")
+	assert.Assert(suite.T(), speed.Direction == nil)
+	assert.Assert(suite.T(), speed.Beaufort == nil)
+}
+
+func (suite *DerivedTestSuite) TestApplyShouldOmitTheDirectionOfCalmWind() {
+	// Given
+	options := outputOptions{
+		windFields: map[string]bool{magnitudeField: true, directionField: true, compassField: true, beaufortField: true},
+		upstream:   canonicalUnits,
+		units:      canonicalUnits,
+	}
+
+	// When
+	speed := options.apply(Windspeed{North: 0, West: 0, Date: "2018-08-01T00:00:00Z"}).(Windspeed)
+
+	// Then
+	assert.Equal(suite.T(), *speed.Magnitude, 0.0)
+	assert.Equal(suite.T(), *speed.Beaufort, 0)
+	assert.Assert(suite.T(), speed.Direction == nil)
+	assert.Equal(suite.T(), speed.Compass, "")
+}
+
+func (suite *DerivedTestSuite) TestComfortMetricsShouldApplyWindChillWhenColdAndWindy() {
+	// When
+	metrics := comfortMetrics(-10, 20/3.6)
+
+	// Then
+	assert.Equal(suite.T(), math.Round(*metrics.WindChill*10)/10, -17.9)
+	assert.Equal(suite.T(), *metrics.ApparentTemp, *metrics.WindChill)
+}
+
+func (suite *DerivedTestSuite) TestComfortMetricsShouldOmitWindChillOutOfItsDomain() {
+	// When
+	warm := comfortMetrics(15, 10)
+	calm := comfortMetrics(-5, 1)
+
+	// Then
+	assert.Assert(suite.T(), warm.WindChill == nil)
+	assert.Equal(suite.T(), *warm.ApparentTemp, 15.0)
+	assert.Assert(suite.T(), calm.WindChill == nil)
+	assert.Equal(suite.T(), *calm.ApparentTemp, -5.0)
+}
+
+func (suite *DerivedTestSuite) TestComfortMetricsShouldOmitImplausibleInputs() {
+	// When
+	metrics := comfortMetrics(80, 10)
+
+	// Then
+	assert.DeepEqual(suite.T(), metrics, ComfortMetrics{})
+}
+
+func (suite *DerivedTestSuite) TestApplyShouldComputeDerivedMetricsBeforeConvertingUnits() {
+	// Given
+	options := outputOptions{
+		windFields: map[string]bool{magnitudeField: true, beaufortField: true},
+		comfort:    true,
+		upstream:   Units{Temp: kelvin, Wind: kilometersPerHour},
+		units:      Units{Temp: fahrenheit, Wind: knots},
+	}
+
+	// When
+	weather := options.apply(Weather{Temp: 263.15, North: 20, Date: "2018-08-01T00:00:00Z"}).(Weather)
+
+	// Then
+	assert.Equal(suite.T(), math.Round(weather.Temp*100)/100, 14.0)
+	assert.Equal(suite.T(), math.Round(weather.North*100)/100, 10.8)
+	assert.Equal(suite.T(), math.Round(*weather.Magnitude*100)/100, 10.8)
+	assert.Equal(suite.T(), *weather.Beaufort, 4)
+	assert.Equal(suite.T(), math.Round(*weather.WindChill*100)/100, -0.15)
+}
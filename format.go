@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	jsonFormat   = "json"
+	csvFormat    = "csv"
+	ndjsonFormat = "ndjson"
+)
+
+// getFormatFromRequest reads the response format from format, or from the
+// Accept header when missing. JSON is answered by default.
+func getFormatFromRequest(c echo.Context) (string, *HttpError) {
+	switch c.QueryParam("format") {
+	case jsonFormat:
+		return jsonFormat, nil
+	case csvFormat:
+		return csvFormat, nil
+	case ndjsonFormat:
+		return ndjsonFormat, nil
+	case "":
+		accept := c.Request().Header.Get(echo.HeaderAccept)
+		if strings.Contains(accept, "text/csv") {
+			return csvFormat, nil
+		}
+		if strings.Contains(accept, ndjsonContentType) {
+			return ndjsonFormat, nil
+		}
+		return jsonFormat, nil
+	}
+	return "", &HttpError{http.StatusText(http.StatusBadRequest), "Please provide format among json, csv, ndjson"}
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvErrorCountHeader counts the days of a CSV response that failed.
+const csvErrorCountHeader = "X-Error-Count"
+
+// respondCSV writes the observations of a range as RFC 4180 CSV, one column
+// per field in the order of the struct fields. Derived fields only get a
+// column when requested, so every page of a range has the same columns.
+// The failed days follow the observations after an empty line, as a second
+// table of date, upstream, type and message, and the following page is
+// linked from the Link header.
+func respondCSV(c echo.Context, page rangePage, response RangeResponse, options outputOptions) error {
+	columns := csvColumns(reflect.TypeOf(response.Data[0]), options)
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, csvFilename(c, page)))
+	header.Set(csvErrorCountHeader, strconv.Itoa(len(response.Errors)))
+	if response.Next != "" {
+		header.Set("Link", fmt.Sprintf(`<%s>; rel="next"`, response.Next))
+	}
+	c.Response().WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(c.Response())
+	writer.UseCRLF = true
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.name
+	}
+	writer.Write(record)
+
+	for _, observation := range response.Data {
+		value := reflect.ValueOf(observation)
+		for i, column := range columns {
+			record[i] = formatCSVValue(value.FieldByIndex(column.index))
+		}
+		writer.Write(record)
+	}
+
+	if len(response.Errors) > 0 {
+		writer.Flush()
+		if _, err := c.Response().Write([]byte("\r\n")); err != nil {
+			return err
+		}
+		writer.Write([]string{"date", "upstream", "type", "message"})
+		for _, rangeError := range response.Errors {
+			writer.Write([]string{rangeError.Date, rangeError.Upstream, rangeError.Error.Type, rangeError.Error.Message})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvColumns(observation reflect.Type, options outputOptions) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < observation.NumField(); i++ {
+		field := observation.Field(i)
+		if field.Anonymous {
+			for _, column := range csvColumns(field.Type, options) {
+				column.index = append([]int{i}, column.index...)
+				columns = append(columns, column)
+			}
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if options.includes(name) {
+			columns = append(columns, csvColumn{name, []int{i}})
+		}
+	}
+	return columns
+}
+
+func formatCSVValue(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	case reflect.Int:
+		return strconv.FormatInt(value.Int(), 10)
+	}
+	return value.String()
+}
+
+// csvFilename names the file after the resource and the dates of the page,
+// eg. weather_2018-08-01_2018-08-31.csv.
+func csvFilename(c echo.Context, page rangePage) string {
+	layout := "2006-01-02"
+	if !page.start.Equal(page.start.Truncate(24*time.Hour)) || !page.end.Equal(page.end.Truncate(24*time.Hour)) {
+		layout = "2006-01-02T1504Z"
+	}
+	resource := strings.Trim(c.Request().URL.Path, "/")
+	return resource + "_" + page.start.Format(layout) + "_" + page.end.Format(layout) + ".csv"
+}
@@ -1,36 +1,68 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 )
 
 type Gateway interface {
-	GetResourceAt(date string, resource interface{}) *HttpError
+	GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError
 }
 
 type GatewayModule struct {
+	mu         sync.RWMutex
 	baseURL    string
+	unit       string
 	httpClient *HttpClient
 }
 
-func NewTemperatureGateway(client *HttpClient) *GatewayModule {
+func NewTemperatureGateway(config UpstreamConfig, client *HttpClient) *GatewayModule {
 	return &GatewayModule{
-		baseURL:    os.Getenv("TEMPERATURE_BASE_URL"),
+		baseURL:    config.BaseURL,
+		unit:       config.Unit,
 		httpClient: client,
 	}
 }
 
-func NewWindspeedGateway(client *HttpClient) *GatewayModule {
+func NewWindspeedGateway(config UpstreamConfig, client *HttpClient) *GatewayModule {
 	return &GatewayModule{
-		baseURL:    os.Getenv("WINDSPEED_BASE_URL"),
+		baseURL:    config.BaseURL,
+		unit:       normalizeWindUnit(config.Unit),
 		httpClient: client,
 	}
 }
 
-func (g *GatewayModule) GetResourceAt(date string, resource interface{}) *HttpError {
-	body, httpError := g.httpClient.MakeRequest(http.MethodGet, g.baseURL+"?at="+date)
+// BaseURL is the URL the upstream is requested at.
+func (g *GatewayModule) BaseURL() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.baseURL
+}
+
+// SetBaseURL points the gateway to another URL. Requests already sent are
+// left to finish.
+func (g *GatewayModule) SetBaseURL(baseURL string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.baseURL = baseURL
+}
+
+// Unit is the unit the upstream reports its values in.
+func (g *GatewayModule) Unit() string {
+	return g.unit
+}
+
+// Probe checks the upstream answers by requesting the current day once.
+func (g *GatewayModule) Probe(ctx context.Context) *HttpError {
+	date := time.Now().UTC().Truncate(time.Hour * 24).Format(dateLayout)
+	return g.httpClient.Probe(ctx, g.BaseURL()+"?at="+date)
+}
+
+func (g *GatewayModule) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	body, httpError := g.httpClient.MakeRequest(ctx, http.MethodGet, g.BaseURL()+"?at="+date)
 	if httpError != nil {
 		return httpError
 	}
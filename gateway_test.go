@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
-	"os"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -19,11 +19,6 @@ func TestGatewayTestSuite(t *testing.T) {
 	suite.Run(t, new(GatewayTestSuite))
 }
 
-func (suite *GatewayTestSuite) SetupTest() {
-	os.Setenv("TEMPERATURE_BASE_URL", "http://baseurl.com")
-	os.Setenv("WINDSPEED_BASE_URL", "http://baseurl.com")
-}
-
 func (suite *GatewayTestSuite) TestTemperatureGatewayShouldReturnTemperatureForAGivenDate() {
 	// Given
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,11 +35,11 @@ func (suite *GatewayTestSuite) TestTemperatureGatewayShouldReturnTemperatureForA
 	httpClient := &HttpClient{
 		client: NewHttpClientForTesting(handler),
 	}
-	suite.gateway = NewTemperatureGateway(httpClient)
+	suite.gateway = NewTemperatureGateway(UpstreamConfig{BaseURL: "http://baseurl.com", Unit: celsius}, httpClient)
 
 	// When
 	var temperature Temperature
-	err := suite.gateway.GetResourceAt("2018-08-12T12:00:00Z", &temperature)
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-12T12:00:00Z", &temperature)
 
 	// Then
 	assert.Assert(suite.T(), err == nil)
@@ -71,11 +66,11 @@ func (suite *GatewayTestSuite) TestWindspeedGatewayShouldReturnWindspeedForAGive
 	httpClient := &HttpClient{
 		client: NewHttpClientForTesting(handler),
 	}
-	suite.gateway = NewWindspeedGateway(httpClient)
+	suite.gateway = NewWindspeedGateway(UpstreamConfig{BaseURL: "http://baseurl.com", Unit: metersPerSecond}, httpClient)
 
 	// When
 	var speed Windspeed
-	err := suite.gateway.GetResourceAt("2018-08-12T12:00:00Z", &speed)
+	err := suite.gateway.GetResourceAt(context.Background(), "2018-08-12T12:00:00Z", &speed)
 
 	// Then
 	assert.Assert(suite.T(), err == nil)
@@ -98,11 +93,11 @@ func (suite *GatewayTestSuite) TestGatewayShouldReturnErrorWhenStatusCodeIsNotOK
 	httpClient := &HttpClient{
 		client: NewHttpClientForTesting(handler),
 	}
-	suite.gateway = NewTemperatureGateway(httpClient)
+	suite.gateway = NewTemperatureGateway(UpstreamConfig{BaseURL: "http://baseurl.com", Unit: celsius}, httpClient)
 
 	// When
 	var temperature Temperature
-	err := suite.gateway.GetResourceAt("", &temperature)
+	err := suite.gateway.GetResourceAt(context.Background(), "", &temperature)
 
 	// Then
 	assert.DeepEqual(suite.T(), *err, HttpError{
@@ -120,11 +115,11 @@ func (suite *GatewayTestSuite) TestGatewayShouldReturnErrorWhenStatusBodyIsEmpty
 	httpClient := &HttpClient{
 		client: NewHttpClientForTesting(handler),
 	}
-	suite.gateway = NewTemperatureGateway(httpClient)
+	suite.gateway = NewTemperatureGateway(UpstreamConfig{BaseURL: "http://baseurl.com", Unit: celsius}, httpClient)
 
 	// When
 	var temperature Temperature
-	err := suite.gateway.GetResourceAt("", &temperature)
+	err := suite.gateway.GetResourceAt(context.Background(), "", &temperature)
 
 	// Then
 	assert.DeepEqual(suite.T(), *err, HttpError{
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	dependencyUp   = "up"
+	dependencyDown = "down"
+
+	ready    = "ready"
+	notReady = "not ready"
+)
+
+// HealthSettings tune the probes of the upstreams behind /readyz.
+type HealthSettings struct {
+	// Timeout bounds each probe.
+	Timeout time.Duration
+	// TTL is how long a probe result is answered before probing again, so
+	// that frequent readiness checks do not load the upstreams.
+	TTL time.Duration
+}
+
+func DefaultHealthSettings() HealthSettings {
+	return HealthSettings{
+		Timeout: time.Second * 2,
+		TTL:     time.Second * 5,
+	}
+}
+
+// DependencyStatus is the outcome of the last probe of an upstream, along
+// with the last error it answered, which is kept once it recovered.
+type DependencyStatus struct {
+	Status      string     `json:"status"`
+	Required    bool       `json:"required"`
+	LatencyMs   float64    `json:"latency_ms"`
+	CheckedAt   string     `json:"checked_at"`
+	LastError   *HttpError `json:"last_error,omitempty"`
+	LastErrorAt string     `json:"last_error_at,omitempty"`
+}
+
+// ReadinessResponse is answered by /readyz.
+type ReadinessResponse struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Probe checks an upstream, sharing its result with every check made within
+// the TTL. Concurrent checks wait for the probe in flight.
+type Probe struct {
+	gateway  *GatewayModule
+	settings HealthSettings
+
+	mu      sync.Mutex
+	status  DependencyStatus
+	checked time.Time
+}
+
+func NewProbe(gateway *GatewayModule, settings HealthSettings) *Probe {
+	return &Probe{gateway: gateway, settings: settings}
+}
+
+// Check answers the status of the upstream, probing it when the last result
+// expired. A probe is not bound to the request asking for it, so that a
+// client going away does not record the upstream as down.
+func (p *Probe) Check() DependencyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.checked.IsZero() && time.Since(p.checked) < p.settings.TTL {
+		return p.status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.settings.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := p.gateway.Probe(ctx)
+	p.checked = time.Now()
+
+	p.status.Status = dependencyUp
+	p.status.LatencyMs = float64(p.checked.Sub(start)) / float64(time.Millisecond)
+	p.status.CheckedAt = p.checked.UTC().Format(time.RFC3339)
+	if err != nil {
+		p.status.Status = dependencyDown
+		p.status.LastError = err
+		p.status.LastErrorAt = p.status.CheckedAt
+	}
+	return p.status
+}
+
+// Reset forgets the last result, so that the next check probes the upstream
+// again. The last error is kept.
+func (p *Probe) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checked = time.Time{}
+}
+
+// GetHealth answers as long as the process serves requests.
+func (m *Module) GetHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GetReadiness probes every upstream at once and answers 503 when any
+// required one is down.
+func (m *Module) GetReadiness(c echo.Context) error {
+	required := map[string]bool{
+		temperatureUpstream: m.currentConfig().Temperature.Required,
+		windspeedUpstream:   m.currentConfig().Windspeed.Required,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	response := ReadinessResponse{Status: ready, Dependencies: make(map[string]DependencyStatus)}
+	for name, probe := range m.probes {
+		wg.Add(1)
+		go func(name string, probe *Probe) {
+			defer wg.Done()
+			status := probe.Check()
+			status.Required = required[name]
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Dependencies[name] = status
+			if status.Required && status.Status == dependencyDown {
+				response.Status = notReady
+			}
+		}(name, probe)
+	}
+	wg.Wait()
+
+	if response.Status != ready {
+		return c.JSON(http.StatusServiceUnavailable, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
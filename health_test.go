@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type HealthTestSuite struct {
+	suite.Suite
+	module       *Module
+	echo         *echo.Echo
+	config       Config
+	temperatures *httptest.Server
+	speeds       *httptest.Server
+	status       int32
+	probes       int32
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
+
+func (suite *HealthTestSuite) SetupTest() {
+	suite.status = http.StatusOK
+	suite.probes = 0
+	suite.temperatures = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&suite.probes, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&suite.status)))
+		w.Write([]byte(`{"message": "Temperatures are unavailable"}`))
+	}))
+	suite.speeds = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"north": 1, "west": 2}`))
+	}))
+
+	suite.config = DefaultConfig()
+	suite.config.Temperature.BaseURL = suite.temperatures.URL
+	suite.config.Windspeed.BaseURL = suite.speeds.URL
+	suite.module = newTestModule(suite.T(), suite.config)
+	suite.echo = echo.New()
+	suite.module.RegisterRoutes(suite.echo)
+}
+
+func (suite *HealthTestSuite) TearDownTest() {
+	suite.temperatures.Close()
+	suite.speeds.Close()
+}
+
+func (suite *HealthTestSuite) readiness() (int, ReadinessResponse) {
+	rec := serve(suite.echo, http.MethodGet, "/readyz", "")
+	var response ReadinessResponse
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	return rec.Code, response
+}
+
+func (suite *HealthTestSuite) expireProbes() {
+	for _, probe := range suite.module.probes {
+		probe.settings.TTL = 0
+	}
+}
+
+func (suite *HealthTestSuite) TestHealthShouldAnswerOK() {
+	// When
+	rec := serve(suite.echo, http.MethodGet, "/healthz", "")
+
+	// Then
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.Equal(suite.T(), rec.Body.String(), `{"status":"ok"}`+"\n")
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldReportEveryUpstream() {
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusOK)
+	assert.Equal(suite.T(), response.Status, ready)
+	assert.Equal(suite.T(), len(response.Dependencies), 2)
+	for _, status := range response.Dependencies {
+		assert.Equal(suite.T(), status.Status, dependencyUp)
+		assert.Assert(suite.T(), status.Required)
+		assert.Assert(suite.T(), status.LatencyMs > 0)
+		assert.Assert(suite.T(), status.LastError == nil)
+		_, err := time.Parse(time.RFC3339, status.CheckedAt)
+		assert.NilError(suite.T(), err)
+	}
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldBeUnavailableWhenARequiredUpstreamIsDown() {
+	// Given
+	suite.status = http.StatusBadGateway
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusServiceUnavailable)
+	assert.Equal(suite.T(), response.Status, notReady)
+	temperature := response.Dependencies[temperatureUpstream]
+	assert.Equal(suite.T(), temperature.Status, dependencyDown)
+	assert.DeepEqual(suite.T(), *temperature.LastError, HttpError{http.StatusText(http.StatusBadGateway), "Temperatures are unavailable"})
+	assert.Equal(suite.T(), temperature.LastErrorAt, temperature.CheckedAt)
+	assert.Equal(suite.T(), response.Dependencies[windspeedUpstream].Status, dependencyUp)
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldReportUnreachableUpstreams() {
+	// Given
+	suite.speeds.Close()
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusServiceUnavailable)
+	assert.Equal(suite.T(), response.Dependencies[windspeedUpstream].Status, dependencyDown)
+	assert.Equal(suite.T(), response.Dependencies[windspeedUpstream].LastError.Type, http.StatusText(http.StatusInternalServerError))
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldIgnoreOptionalUpstreamsDown() {
+	// Given
+	suite.status = http.StatusServiceUnavailable
+	suite.config.Temperature.Required = false
+	suite.module.loadConfig = func() (Config, error) {
+		return suite.config, nil
+	}
+	suite.module.Reload()
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusOK)
+	assert.Equal(suite.T(), response.Status, ready)
+	assert.Equal(suite.T(), response.Dependencies[temperatureUpstream].Status, dependencyDown)
+	assert.Assert(suite.T(), !response.Dependencies[temperatureUpstream].Required)
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldConsiderClientErrorsUp() {
+	// Given
+	suite.status = http.StatusNotFound
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusOK)
+	assert.Equal(suite.T(), response.Dependencies[temperatureUpstream].Status, dependencyUp)
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldCacheProbes() {
+	// Given
+	suite.readiness()
+	atomic.StoreInt32(&suite.status, http.StatusInternalServerError)
+
+	// When
+	code, _ := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusOK)
+	assert.Equal(suite.T(), atomic.LoadInt32(&suite.probes), int32(1))
+}
+
+func (suite *HealthTestSuite) TestReadinessShouldKeepLastErrorOnceRecovered() {
+	// Given
+	suite.expireProbes()
+	atomic.StoreInt32(&suite.status, http.StatusInternalServerError)
+	suite.readiness()
+	atomic.StoreInt32(&suite.status, http.StatusOK)
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	assert.Equal(suite.T(), code, http.StatusOK)
+	assert.Equal(suite.T(), atomic.LoadInt32(&suite.probes), int32(2))
+	temperature := response.Dependencies[temperatureUpstream]
+	assert.Equal(suite.T(), temperature.Status, dependencyUp)
+	assert.Equal(suite.T(), temperature.LastError.Type, http.StatusText(http.StatusInternalServerError))
+}
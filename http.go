@@ -1,33 +1,125 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type HttpClient struct {
+	mu     sync.RWMutex
 	client *http.Client
+	retry  RetryPolicy
+	logger zerolog.Logger
 }
 
+// clientClosedRequest is the type of the errors of lookups canceled by a
+// client that went away.
+const clientClosedRequest = "Client Closed Request"
+
 type HttpError struct {
 	Type    string `json:"type,omitempty"`
 	Message string `json:"message,omitempty"`
 }
 
-func NewHttpClient() *HttpClient {
-	return &HttpClient{
-		client: &http.Client{
-			Timeout:   time.Second * 10,
-			Transport: &http.Transport{MaxConnsPerHost: 50},
+// RetryPolicy describes how a failed upstream request is attempted again.
+// The zero value makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseBackoff is the wait after the first failure, doubled on every
+	// following attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Jitter is the fraction (0 to 1) of each backoff that is randomized.
+	Jitter float64
+	// RetryStatuses lists the response status codes worth another attempt.
+	RetryStatuses map[int]bool
+	// RetryError reports whether a transport error is worth another attempt.
+	RetryError func(err error) bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond * 100,
+		MaxBackoff:  time.Second * 2,
+		Jitter:      0.5,
+		RetryStatuses: map[int]bool{
+			http.StatusBadGateway:         true,
+			http.StatusServiceUnavailable: true,
+			http.StatusGatewayTimeout:     true,
 		},
+		RetryError: isTransientNetworkError,
 	}
 }
 
+// HttpSettings bounds the requests made by an HttpClient.
+type HttpSettings struct {
+	// Timeout bounds each attempt, from dialing to reading the body.
+	Timeout         time.Duration
+	MaxConnsPerHost int
+}
+
+func DefaultHttpSettings() HttpSettings {
+	return HttpSettings{
+		Timeout:         time.Second * 10,
+		MaxConnsPerHost: 50,
+	}
+}
+
+func NewHttpClient(settings HttpSettings, retry RetryPolicy, logger zerolog.Logger) *HttpClient {
+	return &HttpClient{
+		client: newClient(settings),
+		retry:  retry,
+		logger: logger,
+	}
+}
+
+func newClient(settings HttpSettings) *http.Client {
+	return &http.Client{
+		Timeout:   settings.Timeout,
+		Transport: &http.Transport{MaxConnsPerHost: settings.MaxConnsPerHost},
+	}
+}
+
+// Configure swaps the client for one with the given settings. Requests
+// already sent finish on the previous client, whose idle connections are
+// closed.
+func (c *HttpClient) Configure(settings HttpSettings) {
+	c.mu.Lock()
+	previous := c.client
+	c.client = newClient(settings)
+	c.mu.Unlock()
+	previous.CloseIdleConnections()
+}
+
+func (c *HttpClient) httpClient() *http.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
 func NewHttpClientForTesting(handler http.Handler) *http.Client {
 	s := httptest.NewServer(handler)
 	return &http.Client{
@@ -39,24 +131,205 @@ func NewHttpClientForTesting(handler http.Handler) *http.Client {
 	}
 }
 
-func (c *HttpClient) MakeRequest(method string, url string) ([]byte, *HttpError) {
-	response, err := c.client.Get(url)
+// MakeRequest sends a request within a client span, propagating the trace
+// context to the upstream.
+func (c *HttpClient) MakeRequest(ctx context.Context, method string, url string) ([]byte, *HttpError) {
+	ctx, span := tracer().Start(ctx, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethodKey.String(method), semconv.HTTPURLKey.String(url)),
+	)
+	defer span.End()
+
+	body, err := c.do(ctx, url, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, method, url, nil)
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Type+" "+err.Message)
+	}
+	return body, err
+}
+
+// Probe sends a single GET request to url, without retrying, and fails only
+// when no response came back or the upstream answered a server error.
+func (c *HttpClient) Probe(ctx context.Context, url string) *HttpError {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &HttpError{http.StatusText(http.StatusInternalServerError), err.Error()}
+	}
+
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return transportError(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		return validateResponseStatus(response)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	return nil
+}
+
+// PostJSON posts body to url with the given extra headers, retrying like
+// MakeRequest.
+func (c *HttpClient) PostJSON(ctx context.Context, url string, body []byte, header http.Header) ([]byte, *HttpError) {
+	return c.do(ctx, url, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		return request, nil
+	})
+}
+
+// do attempts the request built by newRequest until it succeeds, the retry
+// policy gives up or ctx is done.
+func (c *HttpClient) do(ctx context.Context, url string, newRequest func() (*http.Request, error)) ([]byte, *HttpError) {
+	for attempt := 1; ; attempt++ {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.attempts", attempt))
+		result := c.attempt(ctx, newRequest)
+		if result.err == nil || !result.retryable || attempt >= c.retry.MaxAttempts {
+			return result.body, result.err
+		}
+
+		backoff, ok := c.retry.backoff(attempt, result.retryAfter)
+		if !ok {
+			c.logger.Warn().Str("url", url).Int("attempt", attempt).Dur("retry_after", result.retryAfter).
+				Msg("Giving up, upstream asked to retry later than the maximum backoff")
+			return result.body, result.err
+		}
+
+		c.logger.Warn().Str("url", url).Int("attempt", attempt).Dur("backoff", backoff).
+			Msg(result.err.Type + " " + result.err.Message)
+		if !sleep(ctx, backoff) {
+			return nil, contextError(ctx.Err())
+		}
+	}
+}
+
+type attemptResult struct {
+	body       []byte
+	err        *HttpError
+	retryable  bool
+	retryAfter time.Duration
+}
+
+func (c *HttpClient) attempt(ctx context.Context, newRequest func() (*http.Request, error)) attemptResult {
+	request, err := newRequest()
 	if err != nil {
-		return nil, &HttpError{http.StatusText(http.StatusInternalServerError), err.Error()}
+		return attemptResult{err: &HttpError{http.StatusText(http.StatusInternalServerError), err.Error()}}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return attemptResult{
+			err:       transportError(err),
+			retryable: c.retry.RetryError != nil && c.retry.RetryError(err),
+		}
 	}
 	defer response.Body.Close()
 
 	httpError := validateResponseStatus(response)
 	if httpError != nil {
-		return nil, httpError
+		return attemptResult{
+			err:        httpError,
+			retryable:  c.retry.RetryStatuses[response.StatusCode],
+			retryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
 	}
 
 	responseBody, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return nil, &HttpError{http.StatusText(http.StatusInternalServerError), err.Error()}
+		return attemptResult{
+			err:       transportError(err),
+			retryable: c.retry.RetryError != nil && c.retry.RetryError(err),
+		}
+	}
+
+	return attemptResult{body: responseBody}
+}
+
+// backoff returns how long to wait after the given failed attempt. A
+// Retry-After asked by the upstream is honored as long as it does not exceed
+// MaxBackoff, otherwise no further attempt should be made.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if p.MaxBackoff > 0 && retryAfter > p.MaxBackoff {
+		return 0, false
 	}
 
-	return responseBody, nil
+	backoff := p.BaseBackoff << uint(attempt-1)
+	if backoff <= 0 || (p.MaxBackoff > 0 && backoff > p.MaxBackoff) {
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * p.Jitter * float64(backoff))
+	}
+
+	if retryAfter > backoff {
+		return retryAfter, true
+	}
+	return backoff, true
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// sleep waits for d, returning false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// transportError describes a request that got no complete response. A
+// timeout is answered as a gateway timeout.
+func transportError(err error) *HttpError {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return contextError(err)
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return &HttpError{http.StatusText(http.StatusGatewayTimeout), err.Error()}
+	}
+	return &HttpError{http.StatusText(http.StatusInternalServerError), err.Error()}
+}
+
+// isTransientNetworkError reports timeouts, refused and reset connections and
+// connections closed before the response was complete.
+func isTransientNetworkError(err error) bool {
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 func validateResponseStatus(response *http.Response) *HttpError {
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type HttpClientTestSuite struct {
+	suite.Suite
+	retry RetryPolicy
+}
+
+func TestHttpClientTestSuite(t *testing.T) {
+	suite.Run(t, new(HttpClientTestSuite))
+}
+
+func (suite *HttpClientTestSuite) SetupTest() {
+	suite.retry = DefaultRetryPolicy()
+	suite.retry.BaseBackoff = time.Millisecond
+	suite.retry.MaxBackoff = time.Millisecond * 5
+}
+
+func (suite *HttpClientTestSuite) TestMakeRequestShouldRetryUnavailableUpstream() {
+	// Given
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"temp": 10}`))
+	})
+	httpClient := &HttpClient{
+		client: NewHttpClientForTesting(handler),
+		retry:  suite.retry,
+		logger: zerolog.Nop(),
+	}
+
+	// When
+	body, err := httpClient.MakeRequest(context.Background(), http.MethodGet, "http://baseurl.com")
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	assert.Equal(suite.T(), string(body), `{"temp": 10}`)
+	assert.Equal(suite.T(), atomic.LoadInt32(&calls), int32(3))
+}
+
+func (suite *HttpClientTestSuite) TestMakeRequestShouldNotRetryNotFound() {
+	// Given
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	httpClient := &HttpClient{
+		client: NewHttpClientForTesting(handler),
+		retry:  suite.retry,
+		logger: zerolog.Nop(),
+	}
+
+	// When
+	_, err := httpClient.MakeRequest(context.Background(), http.MethodGet, "http://baseurl.com")
+
+	// Then
+	assert.Equal(suite.T(), err.Type, http.StatusText(http.StatusNotFound))
+	assert.Equal(suite.T(), atomic.LoadInt32(&calls), int32(1))
+}
+
+func (suite *HttpClientTestSuite) TestMakeRequestShouldAnswerGatewayTimeoutWhenUpstreamIsTooSlow() {
+	// Given
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	client := NewHttpClientForTesting(handler)
+	client.Timeout = time.Millisecond * 10
+	httpClient := &HttpClient{
+		client: client,
+		logger: zerolog.Nop(),
+	}
+
+	// When
+	_, err := httpClient.MakeRequest(context.Background(), http.MethodGet, "http://baseurl.com")
+
+	// Then
+	assert.Equal(suite.T(), err.Type, http.StatusText(http.StatusGatewayTimeout))
+}
+
+func (suite *HttpClientTestSuite) TestMakeRequestShouldAbortWhenContextIsCanceled() {
+	// Given
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	httpClient := &HttpClient{
+		client: NewHttpClientForTesting(handler),
+		retry:  suite.retry,
+		logger: zerolog.Nop(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*10, cancel)
+
+	// When
+	_, err := httpClient.MakeRequest(ctx, http.MethodGet, "http://baseurl.com")
+
+	// Then
+	assert.DeepEqual(suite.T(), *err, HttpError{clientClosedRequest, "Request canceled by the client"})
+}
+
+func (suite *HttpClientTestSuite) TestMakeRequestShouldStopAfterMaxAttempts() {
+	// Given
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	httpClient := &HttpClient{
+		client: NewHttpClientForTesting(handler),
+		retry:  suite.retry,
+		logger: zerolog.Nop(),
+	}
+
+	// When
+	_, err := httpClient.MakeRequest(context.Background(), http.MethodGet, "http://baseurl.com")
+
+	// Then
+	assert.Equal(suite.T(), err.Type, http.StatusText(http.StatusBadGateway))
+	assert.Equal(suite.T(), atomic.LoadInt32(&calls), int32(suite.retry.MaxAttempts))
+}
+
+func (suite *HttpClientTestSuite) TestMakeRequestShouldGiveUpWhenRetryAfterExceedsMaxBackoff() {
+	// Given
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	httpClient := &HttpClient{
+		client: NewHttpClientForTesting(handler),
+		retry:  suite.retry,
+		logger: zerolog.Nop(),
+	}
+
+	// When
+	_, err := httpClient.MakeRequest(context.Background(), http.MethodGet, "http://baseurl.com")
+
+	// Then
+	assert.Equal(suite.T(), err.Type, http.StatusText(http.StatusServiceUnavailable))
+	assert.Equal(suite.T(), atomic.LoadInt32(&calls), int32(1))
+}
+
+func (suite *HttpClientTestSuite) TestBackoffShouldHonorRetryAfterAndCapAtMaxBackoff() {
+	// Given
+	retry := RetryPolicy{BaseBackoff: time.Second, MaxBackoff: time.Second * 4}
+
+	// When
+	first, _ := retry.backoff(1, 0)
+	capped, _ := retry.backoff(5, 0)
+	retryAfter, ok := retry.backoff(1, time.Second*3)
+
+	// Then
+	assert.Equal(suite.T(), first, time.Second)
+	assert.Equal(suite.T(), capped, time.Second*4)
+	assert.Assert(suite.T(), ok)
+	assert.Equal(suite.T(), retryAfter, time.Second*3)
+	assert.Equal(suite.T(), parseRetryAfter("7"), time.Second*7)
+}
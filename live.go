@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LiveSettings configures the polling of the upstreams for the current weather.
+type LiveSettings struct {
+	// Interval is the time between two polls of the upstreams.
+	Interval time.Duration
+	// Heartbeat is the time between two comments sent to keep streams open.
+	Heartbeat time.Duration
+	// History is the number of past observations kept to resume subscribers.
+	History int
+	// Buffer is the number of observations a slow subscriber may lag behind
+	// before missing some.
+	Buffer int
+}
+
+func DefaultLiveSettings() LiveSettings {
+	return LiveSettings{
+		Interval:  time.Second * 10,
+		Heartbeat: time.Second * 15,
+		History:   100,
+		Buffer:    16,
+	}
+}
+
+// Observation is a polled Weather numbered in polling order.
+type Observation struct {
+	ID      uint64
+	Weather Weather
+}
+
+// LivePoller polls both upstreams for the current weather while anyone is
+// subscribed, and broadcasts every observation to the subscribers.
+type LivePoller struct {
+	settings     LiveSettings
+	temperatures Gateway
+	speeds       Gateway
+	logger       zerolog.Logger
+
+	mu          sync.Mutex
+	subscribers map[chan Observation]bool
+	history     []Observation
+	lastID      uint64
+	stop        chan struct{}
+	closed      bool
+}
+
+func NewLivePoller(settings LiveSettings, temperatures Gateway, speeds Gateway, logger zerolog.Logger) *LivePoller {
+	return &LivePoller{
+		settings:     settings,
+		temperatures: temperatures,
+		speeds:       speeds,
+		logger:       logger,
+		subscribers:  make(map[chan Observation]bool),
+	}
+}
+
+// Subscribe returns the observations kept since lastID and a channel of the
+// following ones. The poller starts with its first subscriber and stops
+// after the last one called unsubscribe. The channel is closed when the
+// poller is.
+func (p *LivePoller) Subscribe(lastID uint64) ([]Observation, <-chan Observation, func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var missed []Observation
+	for _, observation := range p.history {
+		if observation.ID > lastID {
+			missed = append(missed, observation)
+		}
+	}
+
+	ch := make(chan Observation, p.settings.Buffer)
+	if p.closed {
+		close(ch)
+		return missed, ch, func() {}
+	}
+	p.subscribers[ch] = true
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		go p.run(p.stop)
+	}
+
+	unsubscribe := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if !p.subscribers[ch] {
+			return
+		}
+		delete(p.subscribers, ch)
+		if len(p.subscribers) == 0 {
+			close(p.stop)
+			p.stop = nil
+		}
+	}
+	return missed, ch, unsubscribe
+}
+
+// Close stops polling and ends every subscription by closing its channel.
+func (p *LivePoller) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for ch := range p.subscribers {
+		close(ch)
+		delete(p.subscribers, ch)
+	}
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+func (p *LivePoller) run(stop chan struct{}) {
+	ticker := time.NewTicker(p.settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (p *LivePoller) poll() {
+	if weather, ok := currentWeather(context.Background(), time.Now(), p.temperatures, p.speeds, p.logger); ok {
+		p.publish(weather)
+	}
+}
+
+// currentWeather looks up the weather at now on both upstreams. Failures are
+// logged and reported as not ok.
+func currentWeather(ctx context.Context, now time.Time, temperatures Gateway, speeds Gateway, logger zerolog.Logger) (Weather, bool) {
+	date := now.UTC().Format(dateLayout)
+
+	var speed Windspeed
+	if err := speeds.GetResourceAt(ctx, date, &speed); err != nil {
+		logger.Error().Str("upstream", windspeedUpstream).Msg(err.Type + " " + err.Message)
+		return Weather{}, false
+	}
+	var temp Temperature
+	if err := temperatures.GetResourceAt(ctx, date, &temp); err != nil {
+		logger.Error().Str("upstream", temperatureUpstream).Msg(err.Type + " " + err.Message)
+		return Weather{}, false
+	}
+
+	return Weather{North: speed.North, West: speed.West, Temp: temp.Temp, Date: date}, true
+}
+
+func (p *LivePoller) publish(weather Weather) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastID++
+	observation := Observation{ID: p.lastID, Weather: weather}
+	p.history = append(p.history, observation)
+	if len(p.history) > p.settings.History {
+		p.history = p.history[len(p.history)-p.settings.History:]
+	}
+
+	for ch := range p.subscribers {
+		select {
+		case ch <- observation:
+		default:
+			p.logger.Warn().Uint64("id", observation.ID).Msg("Subscriber is lagging behind, dropping observation")
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type LiveTestSuite struct {
+	suite.Suite
+	module *Module
+	server *httptest.Server
+}
+
+func TestLiveTestSuite(t *testing.T) {
+	suite.Run(t, new(LiveTestSuite))
+}
+
+func (suite *LiveTestSuite) SetupTest() {
+	suite.module = newTestModule(suite.T(), DefaultConfig())
+	suite.module.liveSettings = LiveSettings{Interval: time.Millisecond * 10, Heartbeat: time.Millisecond * 5, History: 2, Buffer: 16}
+	suite.module.live = NewLivePoller(
+		suite.module.liveSettings,
+		&currentGatewayMock{value: Temperature{Temp: -5}},
+		&currentGatewayMock{value: Windspeed{North: 6, West: 8}},
+		suite.module.logger,
+	)
+	router := echo.New()
+	suite.module.RegisterRoutes(router)
+	suite.server = httptest.NewServer(router)
+}
+
+func (suite *LiveTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *LiveTestSuite) TestSubscribeShouldReplayTheKeptHistory() {
+	// Given
+	poller := NewLivePoller(LiveSettings{Interval: time.Hour, History: 2, Buffer: 1}, &currentGatewayMock{}, &currentGatewayMock{}, suite.module.logger)
+	poller.publish(Weather{Temp: 1})
+	poller.publish(Weather{Temp: 2})
+	poller.publish(Weather{Temp: 3})
+
+	// When
+	missed, _, unsubscribe := poller.Subscribe(1)
+	defer unsubscribe()
+	fresh, _, unsubscribeFresh := poller.Subscribe(^uint64(0))
+	defer unsubscribeFresh()
+
+	// Then
+	assert.DeepEqual(suite.T(), missed, []Observation{{ID: 2, Weather: Weather{Temp: 2}}, {ID: 3, Weather: Weather{Temp: 3}}})
+	assert.Equal(suite.T(), len(fresh), 0)
+}
+
+func (suite *LiveTestSuite) TestStreamWeatherShouldSendFilteredEvents() {
+	// Given
+	req, _ := http.NewRequest("GET", suite.server.URL+"/weather/stream?fields=temp,magnitude", nil)
+
+	// When
+	res, err := http.DefaultClient.Do(req)
+	assert.NilError(suite.T(), err)
+	defer res.Body.Close()
+	lines := readEvent(bufio.NewScanner(res.Body))
+
+	// Then
+	var weather map[string]interface{}
+	assert.Equal(suite.T(), res.Header.Get("Content-Type"), sseContentType)
+	assert.Equal(suite.T(), lines[0], "id: 1")
+	assert.Equal(suite.T(), lines[1], "event: weather")
+	assert.NilError(suite.T(), json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &weather))
+	assert.Equal(suite.T(), len(weather), 3)
+	assert.Equal(suite.T(), weather["temp"], -5.0)
+	assert.Equal(suite.T(), weather["magnitude"], 10.0)
+	assert.Assert(suite.T(), weather["date"] != nil)
+}
+
+func (suite *LiveTestSuite) TestStreamWeatherShouldResumeAfterLastEventID() {
+	// Given
+	suite.module.live.publish(Weather{Temp: 1, Date: "2018-08-01T00:00:00Z"})
+	suite.module.live.publish(Weather{Temp: 2, Date: "2018-08-01T00:00:10Z"})
+	req, _ := http.NewRequest("GET", suite.server.URL+"/weather/stream", nil)
+	req.Header.Set("Last-Event-ID", "1")
+
+	// When
+	res, err := http.DefaultClient.Do(req)
+	assert.NilError(suite.T(), err)
+	defer res.Body.Close()
+	lines := readEvent(bufio.NewScanner(res.Body))
+
+	// Then
+	assert.DeepEqual(suite.T(), lines, []string{"id: 2", "event: weather", `data: {"temp":2,"date":"2018-08-01T00:00:10Z"}`})
+}
+
+func (suite *LiveTestSuite) TestStreamWeatherShouldNotReplayTheHistoryToANewClient() {
+	// Given
+	suite.module.live.publish(Weather{Temp: 1, Date: "2018-08-01T00:00:00Z"})
+	suite.module.live.publish(Weather{Temp: 2, Date: "2018-08-01T00:00:10Z"})
+	req, _ := http.NewRequest("GET", suite.server.URL+"/weather/stream", nil)
+
+	// When
+	res, err := http.DefaultClient.Do(req)
+	assert.NilError(suite.T(), err)
+	defer res.Body.Close()
+	lines := readEvent(bufio.NewScanner(res.Body))
+
+	// Then
+	assert.Equal(suite.T(), lines[0], "id: 3")
+	assert.Equal(suite.T(), lines[1], "event: weather")
+}
+
+func (suite *LiveTestSuite) TestStreamWeatherShouldSendHeartbeats() {
+	// Given
+	unavailable := &HttpError{http.StatusText(http.StatusServiceUnavailable), "Service Unavailable"}
+	suite.module.live = NewLivePoller(suite.module.liveSettings, &failingGatewayMock{err: unavailable}, &failingGatewayMock{err: unavailable}, suite.module.logger)
+	req, _ := http.NewRequest("GET", suite.server.URL+"/weather/stream", nil)
+
+	// When
+	res, err := http.DefaultClient.Do(req)
+	assert.NilError(suite.T(), err)
+	defer res.Body.Close()
+	lines := readEvent(bufio.NewScanner(res.Body))
+
+	// Then
+	assert.DeepEqual(suite.T(), lines, []string{": heartbeat"})
+}
+
+func (suite *LiveTestSuite) TestStreamWeatherReturnBadRequestWhenFieldIsUnknown() {
+	// When
+	res, err := http.Get(suite.server.URL + "/weather/stream?fields=humidity")
+
+	// Then
+	assert.NilError(suite.T(), err)
+	defer res.Body.Close()
+	assert.Equal(suite.T(), res.StatusCode, http.StatusBadRequest)
+}
+
+// readEvent returns the lines of the first event or comment following the
+// retry hint.
+func readEvent(scanner *bufio.Scanner) []string {
+	var lines []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "retry:") {
+			continue
+		}
+		if line == "" {
+			if len(lines) > 0 {
+				return lines
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// currentGatewayMock answers the same value whatever the date.
+type currentGatewayMock struct {
+	value interface{}
+}
+
+func (g *currentGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	jsonValue, _ := json.Marshal(g.value)
+	_ = json.Unmarshal(jsonValue, resource)
+	return nil
+}
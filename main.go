@@ -1,24 +1,91 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 )
 
 func main() {
+	config, err := LoadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration: "+err.Error())
+		os.Exit(2)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	if err := run(config, quit); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// run serves until a signal is received on quit. It then stops accepting
+// connections, ends the live streams, waits for the requests in flight for
+// at most the shutdown grace period and closes the module.
+func run(config Config, quit <-chan os.Signal) error {
 	router := echo.New()
 	router.GET("/", func(c echo.Context) error {
 		return c.String(http.StatusOK, "Charly Weather is up")
 	})
 
-	weatherModule := NewModule()
+	weatherModule, err := NewModule(config)
+	if err != nil {
+		return err
+	}
 	weatherModule.RegisterRoutes(router)
+	weatherModule.Start()
+
+	// SIGHUP reloads the configuration, the result being logged.
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer func() {
+		signal.Stop(reloads)
+		close(reloads)
+	}()
+	go func() {
+		for range reloads {
+			weatherModule.Reload()
+		}
+	}()
 
+	router.Use(weatherModule.metrics.Middleware)
+	router.Use(TraceRequests)
 	router.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: "method=${method}, uri=${uri}, status=${status}\n",
 	}))
-	router.Logger.Fatal(router.Start(":" + os.Getenv("PORT")))
+
+	served := make(chan error, 1)
+	go func() {
+		served <- router.Start(config.Listen)
+	}()
+
+	select {
+	case err := <-served:
+		weatherModule.Close()
+		return err
+	case sig := <-quit:
+		weatherModule.logger.Info().Str("signal", sig.String()).Msg("Shutting down, draining requests in flight")
+	}
+
+	weatherModule.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownGrace))
+	defer cancel()
+	if err := router.Shutdown(ctx); err != nil {
+		weatherModule.logger.Error().Msg("Failed to drain requests in flight, dropping them: " + err.Error())
+		router.Close()
+	}
+	if err := weatherModule.Close(); err != nil {
+		return err
+	}
+	weatherModule.logger.Info().Msg("Shut down")
+	return nil
 }
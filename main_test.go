@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type ShutdownTestSuite struct {
+	suite.Suite
+	upstream *httptest.Server
+	requests chan struct{}
+	delay    time.Duration
+	config   Config
+	client   *http.Client
+	quit     chan os.Signal
+	done     chan error
+}
+
+func TestShutdownTestSuite(t *testing.T) {
+	suite.Run(t, new(ShutdownTestSuite))
+}
+
+func (suite *ShutdownTestSuite) SetupTest() {
+	suite.requests = make(chan struct{}, 100)
+	suite.delay = time.Millisecond * 300
+	suite.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.requests <- struct{}{}
+		select {
+		case <-time.After(suite.delay):
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(Temperature{Temp: 10, Date: r.URL.Query().Get("at")})
+	}))
+
+	suite.config = DefaultConfig()
+	suite.config.Listen = freeAddress(suite.T())
+	suite.config.Temperature.BaseURL = suite.upstream.URL
+	suite.config.Windspeed.BaseURL = suite.upstream.URL
+	suite.config.ShutdownGrace = Duration(time.Second * 5)
+	// Idle connections would only be closed by the shutdown after a while.
+	suite.client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	suite.quit = make(chan os.Signal, 1)
+	signal.Notify(suite.quit, syscall.SIGTERM)
+	suite.done = make(chan error, 1)
+}
+
+func (suite *ShutdownTestSuite) TearDownTest() {
+	signal.Stop(suite.quit)
+	suite.upstream.Close()
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// start runs the server and waits for it to answer.
+func (suite *ShutdownTestSuite) start() {
+	go func() {
+		suite.done <- run(suite.config, suite.quit)
+	}()
+	for i := 0; i < 100; i++ {
+		if response, err := suite.client.Get("http://" + suite.config.Listen + "/"); err == nil {
+			response.Body.Close()
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	suite.T().Fatal("server did not start")
+}
+
+// get requests path in the background once the upstream received a lookup.
+func (suite *ShutdownTestSuite) get(path string) <-chan *http.Response {
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := suite.client.Get("http://" + suite.config.Listen + path)
+		if err != nil {
+			response = nil
+		}
+		responses <- response
+	}()
+	<-suite.requests
+	return responses
+}
+
+func (suite *ShutdownTestSuite) terminate() {
+	process, err := os.FindProcess(os.Getpid())
+	assert.NilError(suite.T(), err)
+	assert.NilError(suite.T(), process.Signal(syscall.SIGTERM))
+}
+
+func (suite *ShutdownTestSuite) waitForShutdown(within time.Duration) {
+	select {
+	case err := <-suite.done:
+		assert.NilError(suite.T(), err)
+	case <-time.After(within):
+		suite.T().Fatal("server did not shut down")
+	}
+}
+
+func (suite *ShutdownTestSuite) TestShutdownShouldFinishRequestsInFlight() {
+	// Given
+	suite.start()
+	responses := suite.get("/temperatures?start=2018-08-01T00:00:00Z&end=2018-08-02T00:00:00Z")
+
+	// When
+	suite.terminate()
+
+	// Then
+	response := <-responses
+	assert.Assert(suite.T(), response != nil)
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Equal(suite.T(), response.StatusCode, http.StatusOK)
+	var rangeResponse RangeResponse
+	assert.NilError(suite.T(), json.Unmarshal(body, &rangeResponse))
+	assert.Equal(suite.T(), len(rangeResponse.Data), 2)
+	suite.waitForShutdown(time.Second * 5)
+	_, err := suite.client.Get("http://" + suite.config.Listen + "/")
+	assert.Assert(suite.T(), err != nil)
+}
+
+func (suite *ShutdownTestSuite) TestShutdownShouldDropRequestsAfterGracePeriod() {
+	// Given
+	suite.delay = time.Second * 10
+	suite.config.ShutdownGrace = Duration(time.Millisecond * 50)
+	suite.start()
+	responses := suite.get("/temperatures?start=2018-08-01T00:00:00Z&end=2018-08-01T00:00:00Z")
+
+	// When
+	suite.terminate()
+
+	// Then
+	suite.waitForShutdown(time.Second * 2)
+	assert.Assert(suite.T(), <-responses == nil)
+}
+
+func (suite *ShutdownTestSuite) TestShutdownShouldEndLiveStreams() {
+	// Given
+	suite.start()
+	responses := suite.get("/weather/stream")
+
+	// When
+	suite.terminate()
+
+	// Then
+	response := <-responses
+	assert.Assert(suite.T(), response != nil)
+	defer response.Body.Close()
+	ioutil.ReadAll(response.Body)
+	suite.waitForShutdown(time.Second * 2)
+}
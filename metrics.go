@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the Prometheus collectors of the service. Each module has its
+// own registry so that several modules can live in one process.
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	upstreamCalls    *prometheus.CounterVec
+	upstreamDuration *prometheus.HistogramVec
+	upstreamErrors   *prometheus.CounterVec
+	upstreamTimeouts *prometheus.CounterVec
+	inflightDays     prometheus.Gauge
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charly_http_requests_total",
+			Help: "Requests answered, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "charly_http_request_duration_seconds",
+			Help:    "Time taken to answer requests, by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		upstreamCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charly_upstream_requests_total",
+			Help: "Lookups made to each upstream, retries included.",
+		}, []string{"upstream"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "charly_upstream_request_duration_seconds",
+			Help:    "Time taken by each upstream to answer a lookup, retries included.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"upstream"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charly_upstream_errors_total",
+			Help: "Failed upstream lookups, by upstream and error type.",
+		}, []string{"upstream", "type"}),
+		upstreamTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charly_upstream_timeouts_total",
+			Help: "Upstream lookups that timed out.",
+		}, []string{"upstream"}),
+		inflightDays: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "charly_inflight_days",
+			Help: "Days of ranges being looked up.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.upstreamCalls,
+		m.upstreamDuration,
+		m.upstreamErrors,
+		m.upstreamTimeouts,
+		m.inflightDays,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware counts and times every request by route. Requests matching no
+// route are gathered under "unmatched".
+func (m *Metrics) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		status := responseStatus(c, err)
+		route := c.Path()
+		if err == echo.ErrNotFound || err == echo.ErrMethodNotAllowed {
+			route = "unmatched"
+		}
+
+		labels := prometheus.Labels{"route": route, "method": c.Request().Method, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// responseStatus is the status a request is answered with, once the error
+// returned by its handler is handled.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil {
+		return c.Response().Status
+	}
+	if httpError, ok := err.(*echo.HTTPError); ok {
+		return httpError.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// MetricsGateway counts and times the lookups made to an upstream, along with
+// their failures.
+type MetricsGateway struct {
+	upstream string
+	gateway  Gateway
+	metrics  *Metrics
+}
+
+func NewMetricsGateway(upstream string, gateway Gateway, metrics *Metrics) *MetricsGateway {
+	return &MetricsGateway{upstream: upstream, gateway: gateway, metrics: metrics}
+}
+
+func (g *MetricsGateway) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	start := time.Now()
+	err := g.gateway.GetResourceAt(ctx, date, resource)
+
+	g.metrics.upstreamCalls.WithLabelValues(g.upstream).Inc()
+	g.metrics.upstreamDuration.WithLabelValues(g.upstream).Observe(time.Since(start).Seconds())
+	if err != nil {
+		g.metrics.upstreamErrors.WithLabelValues(g.upstream, err.Type).Inc()
+		if err.Type == http.StatusText(http.StatusGatewayTimeout) {
+			g.metrics.upstreamTimeouts.WithLabelValues(g.upstream).Inc()
+		}
+	}
+	return err
+}
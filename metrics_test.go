@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type MetricsTestSuite struct {
+	suite.Suite
+	module *Module
+	echo   *echo.Echo
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
+
+func (suite *MetricsTestSuite) SetupTest() {
+	suite.module = newTestModule(suite.T(), DefaultConfig())
+	suite.echo = echo.New()
+	suite.echo.Use(suite.module.metrics.Middleware)
+	suite.module.RegisterRoutes(suite.echo)
+}
+
+func (suite *MetricsTestSuite) TestMetricsShouldCountRequestsByRouteAndStatus() {
+	// Given
+	suite.serve("/temperatures?end=2018-08-02T11:00:00Z")
+	suite.serve("/temperatures?end=2018-08-02T11:00:00Z")
+	suite.serve("/unknown")
+
+	// When
+	rec := suite.serve("/metrics")
+
+	// Then
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	body := rec.Body.String()
+	assert.Assert(suite.T(), strings.Contains(body, `charly_http_requests_total{method="GET",route="/temperatures",status="400"} 2`), body)
+	assert.Assert(suite.T(), strings.Contains(body, `charly_http_requests_total{method="GET",route="unmatched",status="404"} 1`), body)
+	assert.Assert(suite.T(), strings.Contains(body, `charly_http_request_duration_seconds_count{method="GET",route="/temperatures",status="400"} 2`), body)
+}
+
+func (suite *MetricsTestSuite) TestMetricsGatewayShouldCountErrorsByTypeAndTimeouts() {
+	// Given
+	gateway := NewMetricsGateway(temperatureUpstream, &failingGatewayMock{
+		err: &HttpError{http.StatusText(http.StatusGatewayTimeout), "Client.Timeout exceeded"},
+	}, suite.module.metrics)
+
+	// When
+	var temp Temperature
+	_ = gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &temp)
+	rec := suite.serve("/metrics")
+
+	// Then
+	body := rec.Body.String()
+	assert.Assert(suite.T(), strings.Contains(body, `charly_upstream_requests_total{upstream="temperature"} 1`), body)
+	assert.Assert(suite.T(), strings.Contains(body, `charly_upstream_errors_total{type="Gateway Timeout",upstream="temperature"} 1`), body)
+	assert.Assert(suite.T(), strings.Contains(body, `charly_upstream_timeouts_total{upstream="temperature"} 1`), body)
+}
+
+func (suite *MetricsTestSuite) serve(target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	return rec
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// StreamTrailer is the last line of an NDJSON stream. It tells it apart from
+// the observations and describes the days that failed.
+type StreamTrailer struct {
+	Trailer bool         `json:"trailer"`
+	Count   int          `json:"count"`
+	Errors  []RangeError `json:"errors"`
+	Next    string       `json:"next,omitempty"`
+	Units   *Units       `json:"units,omitempty"`
+}
+
+// streamNDJSON writes each observation of the page on its own line, in date
+// order, as soon as it and every earlier one resolved, then ends with a
+// StreamTrailer. Since the status is sent with the first line, strict mode
+// stops the stream at the first failure instead of answering an error.
+func (m *Module) streamNDJSON(ctx context.Context, c echo.Context, page rangePage, fetch dayFetcher, options outputOptions) error {
+	strict := c.QueryParam("strict") == "true"
+	trailer := StreamTrailer{Trailer: true, Errors: []RangeError{}, Next: page.next, Units: &options.units}
+	encoder := json.NewEncoder(c.Response())
+	var writeErr error
+
+	err := m.streamRange(ctx, page, fetch, func(value interface{}, dayErrors []RangeError) {
+		if writeErr != nil || (strict && len(trailer.Errors) > 0) {
+			return
+		}
+		if !c.Response().Committed {
+			c.Response().Header().Set(echo.HeaderContentType, ndjsonContentType)
+			c.Response().WriteHeader(http.StatusOK)
+		}
+
+		if len(dayErrors) > 0 {
+			trailer.Errors = append(trailer.Errors, dayErrors...)
+			return
+		}
+		if writeErr = encoder.Encode(options.apply(value)); writeErr == nil {
+			trailer.Count++
+			c.Response().Flush()
+		}
+	})
+	if err != nil {
+		return m.respondUnadmitted(c, err)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if strict && len(trailer.Errors) > 0 {
+		trailer.Next = ""
+	}
+	return encoder.Encode(trailer)
+}
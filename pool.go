@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PoolSettings bounds how many days are looked up at once.
+type PoolSettings struct {
+	// PerRequest is the number of days a single request looks up at once.
+	PerRequest int
+	// Global is the number of days looked up at once across every request.
+	Global int
+	// QueueTimeout is how long a request waits for its first slot before
+	// being rejected.
+	QueueTimeout time.Duration
+}
+
+func DefaultPoolSettings() PoolSettings {
+	return PoolSettings{
+		PerRequest:   10,
+		Global:       50,
+		QueueTimeout: time.Second * 2,
+	}
+}
+
+// WorkerPool shares a global budget of slots between range requests. Each
+// request runs at most PerRequest workers and every day takes a slot only
+// while it is looked up, so a huge range keeps queuing behind smaller
+// requests instead of starving them.
+type WorkerPool struct {
+	settings PoolSettings
+	slots    chan struct{}
+}
+
+func NewWorkerPool(settings PoolSettings) *WorkerPool {
+	return &WorkerPool{
+		settings: settings,
+		slots:    make(chan struct{}, settings.Global),
+	}
+}
+
+// Admit reserves the first slot of a request, waiting at most QueueTimeout
+// and giving up when ctx is done. An admitted request must then call Run,
+// which consumes that slot.
+func (p *WorkerPool) Admit(ctx context.Context) bool {
+	timer := time.NewTimer(p.settings.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run calls work for every index below n on at most PerRequest workers. Once
+// ctx is done no index is dispatched anymore, workers stop waiting for a
+// slot, and skip is called instead of work for every index left.
+func (p *WorkerPool) Run(ctx context.Context, n int, work func(i int), skip func(i int)) {
+	workers := p.settings.PerRequest
+	if workers > n {
+		workers = n
+	}
+
+	admitted := make(chan struct{}, 1)
+	admitted <- struct{}{}
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					skip(i)
+					continue
+				}
+				select {
+				case <-admitted:
+				default:
+					select {
+					case p.slots <- struct{}{}:
+					case <-ctx.Done():
+						skip(i)
+						continue
+					}
+				}
+				work(i)
+				<-p.slots
+			}
+		}()
+	}
+
+	dispatched := 0
+dispatch:
+	for ; dispatched < n; dispatched++ {
+		select {
+		case indexes <- dispatched:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := dispatched; i < n; i++ {
+		skip(i)
+	}
+	// The slot of the admission is released when no worker took it.
+	select {
+	case <-admitted:
+		<-p.slots
+	default:
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type PoolTestSuite struct {
+	suite.Suite
+	pool *WorkerPool
+}
+
+func TestPoolTestSuite(t *testing.T) {
+	suite.Run(t, new(PoolTestSuite))
+}
+
+func (suite *PoolTestSuite) SetupTest() {
+	suite.pool = NewWorkerPool(PoolSettings{
+		PerRequest:   2,
+		Global:       3,
+		QueueTimeout: time.Millisecond * 10,
+	})
+}
+
+func (suite *PoolTestSuite) TestRunShouldNotExceedPerRequestWorkers() {
+	// Given
+	var mu sync.Mutex
+	running, maxRunning, done := 0, 0, 0
+	assert.Assert(suite.T(), suite.pool.Admit(context.Background()))
+
+	// When
+	suite.pool.Run(context.Background(), 20, func(i int) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		done++
+		mu.Unlock()
+	}, func(i int) {
+		suite.T().Fatalf("day %d skipped", i)
+	})
+
+	// Then
+	assert.Equal(suite.T(), done, 20)
+	assert.Equal(suite.T(), maxRunning, 2)
+	assert.Equal(suite.T(), len(suite.pool.slots), 0)
+}
+
+func (suite *PoolTestSuite) TestRunShouldSkipEveryIndexLeftOnceCanceled() {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	worked, skipped := 0, 0
+	assert.Assert(suite.T(), suite.pool.Admit(ctx))
+	time.AfterFunc(time.Millisecond*20, cancel)
+
+	// When
+	suite.pool.Run(ctx, 1000, func(i int) {
+		time.Sleep(time.Millisecond * 5)
+		mu.Lock()
+		worked++
+		mu.Unlock()
+	}, func(i int) {
+		mu.Lock()
+		skipped++
+		mu.Unlock()
+	})
+
+	// Then
+	assert.Assert(suite.T(), worked < 100)
+	assert.Equal(suite.T(), worked+skipped, 1000)
+	assert.Equal(suite.T(), len(suite.pool.slots), 0)
+}
+
+func (suite *PoolTestSuite) TestRunShouldStopWaitingForASlotOnceCanceled() {
+	// Given
+	for i := 0; i < 3; i++ {
+		assert.Assert(suite.T(), suite.pool.Admit(context.Background()))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	worked := make(chan int, 5)
+	skipped := make(chan int, 5)
+
+	// When
+	suite.pool.Run(ctx, 5, func(i int) {
+		<-ctx.Done()
+		worked <- i
+	}, func(i int) {
+		skipped <- i
+	})
+
+	// Then
+	assert.Equal(suite.T(), len(worked), 1)
+	assert.Equal(suite.T(), len(skipped), 4)
+	assert.Equal(suite.T(), len(suite.pool.slots), 2)
+}
+
+func (suite *PoolTestSuite) TestAdmitShouldRejectWhenGlobalBudgetIsExhausted() {
+	// Given
+	for i := 0; i < 3; i++ {
+		assert.Assert(suite.T(), suite.pool.Admit(context.Background()))
+	}
+
+	// When
+	admitted := suite.pool.Admit(context.Background())
+
+	// Then
+	assert.Assert(suite.T(), !admitted)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// RangeSettings bounds the ranges accepted by the range endpoints.
+type RangeSettings struct {
+	// MaxSpan is the longest range between start and end.
+	MaxSpan time.Duration
+	// MaxPoints is the largest number of points answered by a request
+	// without limit.
+	MaxPoints int
+	// MaxLimit is the largest page a client may ask for with limit.
+	MaxLimit int
+}
+
+func DefaultRangeSettings() RangeSettings {
+	return RangeSettings{
+		MaxSpan:   time.Hour * 24 * 366 * 10,
+		MaxPoints: 10000,
+		MaxLimit:  1000,
+	}
+}
+
+const minStep = time.Minute
+
+// rangePage is the part of a range answered by a single request, sampled
+// every step.
+type rangePage struct {
+	start time.Time
+	end   time.Time
+	step  time.Duration
+	next  string
+}
+
+// points returns the number of points sampled between start and end.
+func (p rangePage) points() int {
+	return int(p.end.Sub(p.start)/p.step) + 1
+}
+
+// getRangeFromRequest reads start, end and step. Dates are aligned to the
+// step unless truncate=false asks to sample from the exact start date.
+func getRangeFromRequest(c echo.Context, settings RangeSettings) (rangePage, *HttpError) {
+	step, err := getStepFromRequest(c, settings)
+	if err != nil {
+		return rangePage{}, err
+	}
+
+	startDate, endDate, err := getStartdAndEndDateFromRequest(c)
+	if err != nil {
+		return rangePage{}, err
+	}
+
+	if c.QueryParam("truncate") != "false" {
+		startDate = alignStart(startDate, step)
+	}
+	if !endDate.Before(startDate) {
+		endDate = startDate.Add(endDate.Sub(startDate) / step * step)
+	}
+	if endDate.Before(startDate) {
+		return rangePage{}, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide an end date after the start date"}
+	}
+	if endDate.Sub(startDate) > settings.MaxSpan {
+		return rangePage{}, &HttpError{http.StatusText(http.StatusBadRequest), fmt.Sprintf("Please provide a range of at most %d days", settings.MaxSpan/(24*time.Hour))}
+	}
+	return rangePage{start: startDate, end: endDate, step: step}, nil
+}
+
+// alignStart moves the start of a range to the first point of its day
+// sampled every step, from midnight, that is not before it. Steps of a day
+// or more sample from midnight of the start day.
+func alignStart(start time.Time, step time.Duration) time.Time {
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	if step >= time.Hour*24 {
+		return day
+	}
+	steps := (start.Sub(day) + step - 1) / step
+	return day.Add(steps * step)
+}
+
+func getStartdAndEndDateFromRequest(c echo.Context) (time.Time, time.Time, *HttpError) {
+	start := c.QueryParam("start")
+	end := c.QueryParam("end")
+	if start == "" || end == "" {
+		return time.Now(), time.Now(), &HttpError{http.StatusText(http.StatusBadRequest), "Please provide both start and end dates"}
+	}
+
+	startDate, startErr := time.Parse(dateLayout, start)
+	endDate, err := time.Parse(dateLayout, end)
+	if startErr != nil || err != nil {
+		return time.Now(), time.Now(), &HttpError{http.StatusText(http.StatusBadRequest), "Please provide dates with format ISO8601 DateTime (eg. 2018-08-12T12:00:00Z)"}
+	}
+	return startDate, endDate, nil
+}
+
+// getStepFromRequest reads the sampling interval of the range, one day by
+// default. Besides Go durations (eg. 1h, 30m) it accepts days and weeks
+// (eg. 1d, 2w).
+func getStepFromRequest(c echo.Context, settings RangeSettings) (time.Duration, *HttpError) {
+	step := c.QueryParam("step")
+	if step == "" {
+		return time.Hour * 24, nil
+	}
+
+	duration, err := parseStep(step, settings.MaxSpan)
+	if err != nil || duration < minStep {
+		return 0, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a step of at least one minute (eg. 1h, 6h, 1d, 1w)"}
+	}
+	return duration, nil
+}
+
+// parseStep reads a step, rejecting days and weeks longer than maxSpan,
+// which could otherwise overflow.
+func parseStep(step string, maxSpan time.Duration) (time.Duration, error) {
+	units := map[string]time.Duration{"d": time.Hour * 24, "w": time.Hour * 24 * 7}
+	for suffix, unit := range units {
+		if strings.HasSuffix(step, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(step, suffix))
+			if err != nil {
+				return 0, err
+			}
+			if count > int(maxSpan/unit) {
+				return 0, fmt.Errorf("step %s is longer than %s", step, maxSpan)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(step)
+}
+
+// getPageFromRequest reads limit and page_token to pick the points of the
+// range to answer. Without limit the whole range is a single page. Otherwise
+// next links to the following page, if any.
+func getPageFromRequest(c echo.Context, page rangePage, settings RangeSettings) (rangePage, *HttpError) {
+	endDate := page.end
+
+	if token := c.QueryParam("page_token"); token != "" {
+		pageStart, err := decodePageToken(token)
+		if err != nil || pageStart.Before(page.start) || pageStart.After(endDate) {
+			return page, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a page_token returned by a previous page"}
+		}
+		page.start = pageStart
+	}
+
+	if c.QueryParam("limit") == "" {
+		if page.points() > settings.MaxPoints {
+			return page, &HttpError{http.StatusText(http.StatusBadRequest), fmt.Sprintf("Please provide a limit, a longer step or a shorter range, at most %d points are answered at once", settings.MaxPoints)}
+		}
+		return page, nil
+	}
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil || limit < 1 || limit > settings.MaxLimit {
+		return page, &HttpError{http.StatusText(http.StatusBadRequest), fmt.Sprintf("Please provide a limit between 1 and %d", settings.MaxLimit)}
+	}
+
+	pageEnd := page.start.Add(page.step * time.Duration(limit-1))
+	if pageEnd.Before(endDate) {
+		page.end = pageEnd
+		query := c.Request().URL.Query()
+		query.Set("page_token", encodePageToken(pageEnd.Add(page.step)))
+		page.next = c.Request().URL.Path + "?" + query.Encode()
+	}
+	return page, nil
+}
+
+func encodePageToken(date time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(date.Format(dateLayout)))
+}
+
+func decodePageToken(token string) (time.Time, error) {
+	date, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(dateLayout, string(date))
+}
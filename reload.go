@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// ReloadResult lists the settings changed by a reload, split between the
+// ones applied right away and the ones only applied by a restart.
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reload reads the configuration again and applies it to the running module.
+// The upstream base URLs and whether they are required, the upstream timeout
+// and connection limit and the admin token are swapped without disturbing
+// the lookups in flight. An upstream moved to another base URL gets a closed
+// breaker and a fresh readiness probe. An invalid configuration is rejected
+// as a whole and the current one is kept.
+func (m *Module) Reload() (ReloadResult, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	config, err := m.loadConfig()
+	if err != nil {
+		m.logger.Error().Msg("Failed to reload configuration: " + err.Error())
+		return ReloadResult{}, err
+	}
+
+	previous := m.config
+	if config.Temperature.BaseURL != previous.Temperature.BaseURL {
+		m.moveUpstream(temperatureUpstream, config.Temperature.BaseURL)
+	}
+	if config.Windspeed.BaseURL != previous.Windspeed.BaseURL {
+		m.moveUpstream(windspeedUpstream, config.Windspeed.BaseURL)
+	}
+	if config.HttpSettings() != previous.HttpSettings() {
+		m.httpClient.Configure(config.HttpSettings())
+	}
+
+	result := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	diff := func(list *[]string, name string, changed bool) {
+		if changed {
+			*list = append(*list, name)
+		}
+	}
+	diff(&result.Applied, "temperature.base_url", config.Temperature.BaseURL != previous.Temperature.BaseURL)
+	diff(&result.Applied, "windspeed.base_url", config.Windspeed.BaseURL != previous.Windspeed.BaseURL)
+	diff(&result.Applied, "temperature.required", config.Temperature.Required != previous.Temperature.Required)
+	diff(&result.Applied, "windspeed.required", config.Windspeed.Required != previous.Windspeed.Required)
+	diff(&result.Applied, "upstream.timeout", config.Upstream.Timeout != previous.Upstream.Timeout)
+	diff(&result.Applied, "upstream.max_conns_per_host", config.Upstream.MaxConnsPerHost != previous.Upstream.MaxConnsPerHost)
+	diff(&result.Applied, "admin_token", config.AdminToken != previous.AdminToken)
+	diff(&result.RestartRequired, "listen", config.Listen != previous.Listen)
+	diff(&result.RestartRequired, "log_level", config.LogLevel != previous.LogLevel)
+	diff(&result.RestartRequired, "shutdown_grace", config.ShutdownGrace != previous.ShutdownGrace)
+	diff(&result.RestartRequired, "store_path", config.StorePath != previous.StorePath)
+	diff(&result.RestartRequired, "temperature.unit", config.Temperature.Unit != previous.Temperature.Unit)
+	diff(&result.RestartRequired, "windspeed.unit", config.Windspeed.Unit != previous.Windspeed.Unit)
+	diff(&result.RestartRequired, "pool", config.Pool != previous.Pool)
+	diff(&result.RestartRequired, "ranges", config.Ranges != previous.Ranges)
+	diff(&result.RestartRequired, "breaker", config.Breaker != previous.Breaker)
+	diff(&result.RestartRequired, "cache", config.Cache != previous.Cache)
+	diff(&result.RestartRequired, "live", config.Live != previous.Live)
+	diff(&result.RestartRequired, "tracing", config.Tracing != previous.Tracing)
+	diff(&result.RestartRequired, "alerts", !reflect.DeepEqual(config.Alerts, previous.Alerts))
+
+	// Settings needing a restart are kept as running, so that the next
+	// reload reports them again.
+	config.Listen = previous.Listen
+	config.LogLevel = previous.LogLevel
+	config.ShutdownGrace = previous.ShutdownGrace
+	config.StorePath = previous.StorePath
+	config.Temperature.Unit = previous.Temperature.Unit
+	config.Windspeed.Unit = previous.Windspeed.Unit
+	config.Pool = previous.Pool
+	config.Ranges = previous.Ranges
+	config.Breaker = previous.Breaker
+	config.Cache = previous.Cache
+	config.Live = previous.Live
+	config.Tracing = previous.Tracing
+	config.Alerts = previous.Alerts
+	m.config = config
+
+	m.logger.Info().
+		Strs("applied", result.Applied).
+		Strs("restart_required", result.RestartRequired).
+		Msg("Reloaded configuration")
+	return result, nil
+}
+
+// moveUpstream points an upstream to another base URL. Its breaker and probe
+// judged the previous address, so they start over.
+func (m *Module) moveUpstream(upstream string, baseURL string) {
+	m.gateways[upstream].SetBaseURL(baseURL)
+	m.breakers[upstream].Reset()
+	m.probes[upstream].Reset()
+}
+
+// currentConfig is the configuration as last reloaded.
+func (m *Module) currentConfig() Config {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	return m.config
+}
+
+// requireAdminToken lets through the callers presenting the admin token as a
+// bearer token. Without an admin token configured, the admin calls are
+// forbidden.
+func (m *Module) requireAdminToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := m.currentConfig().AdminToken
+		if token == "" {
+			return m.respondError(c, http.StatusForbidden, &HttpError{http.StatusText(http.StatusForbidden),
+				"Please configure an admin token to call " + c.Path()})
+		}
+		given := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return m.respondError(c, http.StatusUnauthorized, &HttpError{http.StatusText(http.StatusUnauthorized),
+				"Please provide the admin token as a bearer token"})
+		}
+		return next(c)
+	}
+}
+
+// ReloadConfig reloads the configuration, for callers presenting the admin
+// token. Without an admin token configured, reloading is only possible with
+// SIGHUP.
+func (m *Module) ReloadConfig(c echo.Context) error {
+	result, err := m.Reload()
+	if err != nil {
+		return m.respondError(c, http.StatusUnprocessableEntity, &HttpError{http.StatusText(http.StatusUnprocessableEntity), err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type ReloadTestSuite struct {
+	suite.Suite
+	module   *Module
+	echo     *echo.Echo
+	config   Config
+	previous *httptest.Server
+	current  *httptest.Server
+}
+
+func TestReloadTestSuite(t *testing.T) {
+	suite.Run(t, new(ReloadTestSuite))
+}
+
+func upstreamAnswering(temp float64, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(Temperature{Temp: temp, Date: r.URL.Query().Get("at")})
+	}))
+}
+
+func (suite *ReloadTestSuite) SetupTest() {
+	suite.previous = upstreamAnswering(10, 0)
+	suite.current = upstreamAnswering(20, time.Millisecond*50)
+	suite.config = DefaultConfig()
+	suite.config.Temperature.BaseURL = suite.previous.URL
+	suite.config.Windspeed.BaseURL = suite.previous.URL
+	suite.config.AdminToken = "secret"
+	suite.module = newTestModule(suite.T(), suite.config)
+	suite.module.loadConfig = func() (Config, error) {
+		return suite.config, nil
+	}
+	suite.echo = echo.New()
+	suite.module.RegisterRoutes(suite.echo)
+}
+
+func (suite *ReloadTestSuite) TearDownTest() {
+	suite.previous.Close()
+	suite.current.Close()
+}
+
+func (suite *ReloadTestSuite) fetchTemperature() (Temperature, *HttpError) {
+	var temperature Temperature
+	err := suite.module.gateways[temperatureUpstream].GetResourceAt(context.Background(), "2018-08-12T12:00:00Z", &temperature)
+	return temperature, err
+}
+
+func (suite *ReloadTestSuite) reload(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *ReloadTestSuite) TestReloadShouldSwapUpstreamBaseURL() {
+	// Given
+	suite.config.Temperature.BaseURL = suite.current.URL
+
+	// When
+	result, err := suite.module.Reload()
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.DeepEqual(suite.T(), result, ReloadResult{Applied: []string{"temperature.base_url"}, RestartRequired: []string{}})
+	temperature, httpError := suite.fetchTemperature()
+	assert.Assert(suite.T(), httpError == nil)
+	assert.Equal(suite.T(), temperature.Temp, 20.0)
+}
+
+func (suite *ReloadTestSuite) TestReloadShouldResetTheBreakerAndProbeOfAMovedUpstream() {
+	// Given
+	breaker := suite.module.breakers[temperatureUpstream].breaker
+	for i := 0; i < DefaultBreakerSettings().FailureThreshold; i++ {
+		breaker.Record(false)
+	}
+	suite.previous.Close()
+	suite.module.probes[temperatureUpstream].Check()
+	suite.config.Temperature.BaseURL = suite.current.URL
+
+	// When
+	_, err := suite.module.Reload()
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), breaker.Status().State, BreakerClosed)
+	assert.Equal(suite.T(), suite.module.probes[temperatureUpstream].Check().Status, dependencyUp)
+}
+
+func (suite *ReloadTestSuite) TestReloadShouldSwapUpstreamTimeout() {
+	// Given
+	suite.config.Temperature.BaseURL = suite.current.URL
+	suite.config.Upstream.Timeout = Duration(time.Millisecond * 10)
+
+	// When
+	_, err := suite.module.Reload()
+
+	// Then
+	assert.NilError(suite.T(), err)
+	_, httpError := suite.fetchTemperature()
+	assert.DeepEqual(suite.T(), *httpError, HttpError{http.StatusText(http.StatusGatewayTimeout), "Timed out waiting for the upstream"})
+}
+
+func (suite *ReloadTestSuite) TestReloadShouldLetInFlightRequestsFinish() {
+	// Given
+	suite.config.Temperature.BaseURL = suite.current.URL
+	suite.module.Reload()
+	done := make(chan Temperature)
+	go func() {
+		temperature, _ := suite.fetchTemperature()
+		done <- temperature
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	// When
+	suite.config.Temperature.BaseURL = suite.previous.URL
+	suite.config.Upstream.Timeout = Duration(time.Millisecond)
+	suite.config.Upstream.MaxConnsPerHost = 1
+	_, err := suite.module.Reload()
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), (<-done).Temp, 20.0)
+}
+
+func (suite *ReloadTestSuite) TestReloadShouldKeepConfigurationWhenInvalid() {
+	// Given
+	suite.module.loadConfig = func() (Config, error) {
+		return Config{}, errors.New("temperature.base_url: the temperature upstream base URL is required")
+	}
+
+	// When
+	_, err := suite.module.Reload()
+
+	// Then
+	assert.Error(suite.T(), err, "temperature.base_url: the temperature upstream base URL is required")
+	assert.Equal(suite.T(), suite.module.gateways[temperatureUpstream].BaseURL(), suite.previous.URL)
+}
+
+func (suite *ReloadTestSuite) TestReloadShouldReportSettingsRequiringARestart() {
+	// Given
+	suite.config.Listen = ":9000"
+	suite.config.Pool.Global = 100
+	suite.config.Cache.MaxEntries = 10
+	suite.config.Live.Interval = Duration(time.Second)
+	suite.module.Reload()
+
+	// When
+	result, err := suite.module.Reload()
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.DeepEqual(suite.T(), result, ReloadResult{Applied: []string{}, RestartRequired: []string{"listen", "pool", "cache", "live"}})
+}
+
+func (suite *ReloadTestSuite) TestReloadConfigShouldRequireTheAdminToken() {
+	// When
+	missing := suite.reload("")
+	wrong := suite.reload("guess")
+
+	// Then
+	assert.Equal(suite.T(), missing.Code, http.StatusUnauthorized)
+	assert.Equal(suite.T(), wrong.Code, http.StatusUnauthorized)
+	assert.Equal(suite.T(), wrong.Header().Get(echo.HeaderWWWAuthenticate), "Bearer")
+}
+
+func (suite *ReloadTestSuite) TestReloadConfigShouldBeForbiddenWithoutAdminToken() {
+	// Given
+	suite.config.AdminToken = ""
+	suite.module.Reload()
+
+	// When
+	rec := suite.reload("secret")
+
+	// Then
+	assert.Equal(suite.T(), rec.Code, http.StatusForbidden)
+}
+
+func (suite *ReloadTestSuite) TestAdminStatsShouldRequireTheAdminToken() {
+	for _, target := range []string{"/admin/breakers", "/admin/cache", "/admin/coalescing"} {
+		// When
+		missing := serve(suite.echo, http.MethodGet, target, "")
+		given := serveWithToken(suite.echo, http.MethodGet, target, "", "secret")
+
+		// Then
+		assert.Equal(suite.T(), missing.Code, http.StatusUnauthorized, target)
+		assert.Equal(suite.T(), given.Code, http.StatusOK, target)
+	}
+}
+
+func (suite *ReloadTestSuite) TestReloadConfigShouldAnswerTheResult() {
+	// Given
+	suite.config.Windspeed.BaseURL = suite.current.URL
+
+	// When
+	rec := suite.reload("secret")
+
+	// Then
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.Equal(suite.T(), rec.Body.String(), `{"applied":["windspeed.base_url"],"restart_required":[]}`+"\n")
+	assert.Equal(suite.T(), suite.module.gateways[windspeedUpstream].BaseURL(), suite.current.URL)
+}
+
+func (suite *ReloadTestSuite) TestReloadConfigShouldAnswerValidationErrors() {
+	// Given
+	suite.module.loadConfig = func() (Config, error) {
+		return Config{}, errors.New("windspeed.unit: \"knots\" is not among m/s, km/h, mph, kn")
+	}
+
+	// When
+	rec := suite.reload("secret")
+
+	// Then
+	assert.Equal(suite.T(), rec.Code, http.StatusUnprocessableEntity)
+	assert.Equal(suite.T(), rec.Body.String(), `{"type":"Unprocessable Entity","message":"windspeed.unit: \"knots\" is not among m/s, km/h, mph, kn"}`+"\n")
+}
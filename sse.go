@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const sseContentType = "text/event-stream"
+
+// streamFields are the Weather fields a stream can be filtered on. The date
+// is always sent.
+var streamFields = []string{"north", "west", "temp", magnitudeField, directionField, compassField, beaufortField, windChillField, apparentTempField}
+
+// streamOptions shape the events of a single stream connection.
+type streamOptions struct {
+	output outputOptions
+	// fields are the fields sent in each event, every field when nil.
+	fields map[string]bool
+}
+
+// getStreamOptionsFromRequest reads the units and fields, a filter on the
+// Weather fields sent (eg. fields=temp,magnitude). Derived and comfort
+// metrics are only computed when filtered on.
+func getStreamOptionsFromRequest(c echo.Context, upstream Units) (streamOptions, *HttpError) {
+	units, err := getUnitsFromRequest(c, upstream)
+	if err != nil {
+		return streamOptions{}, err
+	}
+	options := streamOptions{output: outputOptions{windFields: make(map[string]bool), upstream: upstream, units: units}}
+
+	for _, field := range splitParam(c.QueryParam("fields")) {
+		if !contains(streamFields, field) {
+			return options, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide fields among " + strings.Join(streamFields, ", ")}
+		}
+		if options.fields == nil {
+			options.fields = map[string]bool{"date": true}
+		}
+		options.fields[field] = true
+		if contains(derivedWindFields, field) {
+			options.output.windFields[field] = true
+		}
+		if field == windChillField || field == apparentTempField {
+			options.output.comfort = true
+		}
+	}
+	return options, nil
+}
+
+// getLastEventID reads the id of the last event a client received, from the
+// Last-Event-ID header sent by reconnecting browsers or the last_event_id
+// parameter. A client starting afresh gets the largest id so that nothing
+// kept in the poller history is replayed to it.
+func getLastEventID(c echo.Context) (uint64, *HttpError) {
+	value := c.Request().Header.Get("Last-Event-ID")
+	if value == "" {
+		value = c.QueryParam("last_event_id")
+	}
+	if value == "" {
+		return ^uint64(0), nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a numeric Last-Event-ID"}
+	}
+	return id, nil
+}
+
+// StreamWeather keeps a Server-Sent Events connection open and sends a
+// weather event each time the live poller observes the current weather.
+// Events missed since Last-Event-ID are replayed first to a resuming client,
+// as far as the poller history goes, and comments are sent as heartbeats.
+func (m *Module) StreamWeather(c echo.Context) error {
+	options, err := getStreamOptionsFromRequest(c, m.units)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	lastID, err := getLastEventID(c)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+
+	missed, observations, unsubscribe := m.live.Subscribe(lastID)
+	defer unsubscribe()
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, sseContentType)
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(response, "retry: %d\n\n", m.liveSettings.Interval/time.Millisecond); err != nil {
+		return err
+	}
+	for _, observation := range missed {
+		if err := writeEvent(response, observation, options); err != nil {
+			return err
+		}
+	}
+	response.Flush()
+
+	heartbeat := time.NewTicker(m.liveSettings.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case observation, ok := <-observations:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(response, observation, options); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+		case <-c.Request().Context().Done():
+			return nil
+		}
+		response.Flush()
+	}
+}
+
+// writeEvent writes an observation as a weather event identified by its id.
+func writeEvent(response *echo.Response, observation Observation, options streamOptions) error {
+	data, err := json.Marshal(options.output.apply(observation.Weather))
+	if err != nil {
+		return err
+	}
+	if options.fields != nil {
+		var values map[string]interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+		for field := range values {
+			if !options.fields[field] {
+				delete(values, field)
+			}
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(response, "id: %d\nevent: weather\ndata: %s\n\n", observation.ID, data)
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists the raw upstream answers of every fetched day.
+type Store interface {
+	Get(upstream string, date string) ([]byte, bool, error)
+	Put(upstream string, date string, body []byte) error
+	Close() error
+}
+
+// NoStore is the Store used without a store path: nothing is persisted, so
+// every day missing from the response cache is fetched again.
+type NoStore struct{}
+
+func (NoStore) Get(upstream string, date string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func (NoStore) Put(upstream string, date string, body []byte) error {
+	return nil
+}
+
+func (NoStore) Close() error {
+	return nil
+}
+
+// OpenStore opens the BoltDB file at path, or persists nothing when path is
+// empty.
+func OpenStore(path string) (Store, error) {
+	if path == "" {
+		return NoStore{}, nil
+	}
+	store, err := NewBoltStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// BoltStore is a Store backed by a BoltDB file, with one bucket per upstream
+// keyed by date.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(upstream string, date string) ([]byte, bool, error) {
+	var body []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(upstream))
+		if bucket == nil {
+			return nil
+		}
+		if value := bucket.Get([]byte(date)); value != nil {
+			body = append([]byte(nil), value...)
+		}
+		return nil
+	})
+	return body, body != nil, err
+}
+
+func (s *BoltStore) Put(upstream string, date string, body []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(upstream))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(date), body)
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// StoreGateway reads days from a Store before asking the upstream, and
+// persists every day it had to fetch. Days that are not over yet may still
+// change upstream, so they are always fetched again.
+type StoreGateway struct {
+	upstream string
+	gateway  Gateway
+	store    Store
+	logger   zerolog.Logger
+}
+
+func NewStoreGateway(upstream string, gateway Gateway, store Store, logger zerolog.Logger) *StoreGateway {
+	return &StoreGateway{
+		upstream: upstream,
+		gateway:  gateway,
+		store:    store,
+		logger:   logger,
+	}
+}
+
+func (g *StoreGateway) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	if isSettled(date) {
+		body, ok, err := g.store.Get(g.upstream, date)
+		if err != nil {
+			g.logger.Error().Str("upstream", g.upstream).Str("date", date).Msg("Failed to read store: " + err.Error())
+		}
+		if ok && json.Unmarshal(body, resource) == nil {
+			return nil
+		}
+	}
+
+	if err := g.gateway.GetResourceAt(ctx, date, resource); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(resource)
+	if err == nil {
+		err = g.store.Put(g.upstream, date, body)
+	}
+	if err != nil {
+		g.logger.Error().Str("upstream", g.upstream).Str("date", date).Msg("Failed to write store: " + err.Error())
+	}
+	return nil
+}
+
+// isSettled reports whether the day holding the given date is already over.
+func isSettled(date string) bool {
+	at, err := time.Parse(dateLayout, date)
+	return err == nil && time.Since(at.Truncate(24*time.Hour)) >= 24*time.Hour
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type StoreTestSuite struct {
+	suite.Suite
+	dir      string
+	upstream *countingGatewayMock
+}
+
+func TestStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(StoreTestSuite))
+}
+
+func (suite *StoreTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "charly-weather")
+	assert.NilError(suite.T(), err)
+	suite.dir = dir
+	suite.upstream = &countingGatewayMock{
+		gateway: &TemperatureGatewayMock{
+			temperatures: map[string]Temperature{
+				"2018-08-01T00:00:00Z": {Temp: 10.5353456000000, Date: "2018-08-01T00:00:00Z"},
+				"2018-08-02T00:00:00Z": {Temp: 13.5353456555445, Date: "2018-08-02T00:00:00Z"},
+			},
+		},
+	}
+}
+
+func (suite *StoreTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *StoreTestSuite) TestBoltStoreShouldKeepObservationsAcrossRestarts() {
+	// Given
+	path := filepath.Join(suite.dir, "weather.db")
+	store, err := NewBoltStore(path)
+	assert.NilError(suite.T(), err)
+	assert.NilError(suite.T(), store.Put("temperature", "2018-08-01T00:00:00Z", []byte(`{"temp":10.5}`)))
+	assert.NilError(suite.T(), store.Close())
+
+	// When
+	store, err = NewBoltStore(path)
+	assert.NilError(suite.T(), err)
+	defer store.Close()
+	body, ok, err := store.Get("temperature", "2018-08-01T00:00:00Z")
+	_, missingOk, missingErr := store.Get("windspeed", "2018-08-01T00:00:00Z")
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Assert(suite.T(), ok)
+	assert.Equal(suite.T(), string(body), `{"temp":10.5}`)
+	assert.NilError(suite.T(), missingErr)
+	assert.Assert(suite.T(), !missingOk)
+}
+
+func (suite *StoreTestSuite) TestStoreGatewayShouldOnlyFetchDaysMissingFromStore() {
+	// Given
+	store := NewMemoryStore()
+	store.Put("temperature", "2018-08-01T00:00:00Z", []byte(`{"temp":9,"date":"2018-08-01T00:00:00Z"}`))
+	gateway := NewStoreGateway("temperature", suite.upstream, store, zerolog.Nop())
+
+	// When
+	var stored, fetched Temperature
+	storedErr := gateway.GetResourceAt(context.Background(), "2018-08-01T00:00:00Z", &stored)
+	fetchedErr := gateway.GetResourceAt(context.Background(), "2018-08-02T00:00:00Z", &fetched)
+
+	// Then
+	assert.Assert(suite.T(), storedErr == nil)
+	assert.Assert(suite.T(), fetchedErr == nil)
+	assert.DeepEqual(suite.T(), stored, Temperature{Temp: 9, Date: "2018-08-01T00:00:00Z"})
+	assert.DeepEqual(suite.T(), fetched, Temperature{Temp: 13.5353456555445, Date: "2018-08-02T00:00:00Z"})
+	assert.Equal(suite.T(), suite.upstream.Calls(), int32(1))
+	_, ok, _ := store.Get("temperature", "2018-08-02T00:00:00Z")
+	assert.Assert(suite.T(), ok)
+}
+
+func (suite *StoreTestSuite) TestNewModuleShouldFailWhenStoreCannotBeOpened() {
+	// Given
+	config := DefaultConfig()
+	config.StorePath = filepath.Join(suite.dir, "missing", "weather.db")
+
+	// When
+	_, err := NewModule(config)
+
+	// Then
+	assert.ErrorContains(suite.T(), err, "store_path: failed to open "+config.StorePath)
+}
+
+func (suite *StoreTestSuite) TestNewModuleShouldPersistNothingWithoutStorePath() {
+	// When
+	module := newTestModule(suite.T(), DefaultConfig())
+	module.store.Put("temperature", "2018-08-01T00:00:00Z", []byte(`{"temp":10.5}`))
+	_, ok, err := module.store.Get("temperature", "2018-08-01T00:00:00Z")
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Assert(suite.T(), !ok)
+}
+
+// MemoryStore is a Store kept in memory for the tests.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[cacheKey][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[cacheKey][]byte)}
+}
+
+func (s *MemoryStore) Get(upstream string, date string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	body, ok := s.values[cacheKey{upstream, date}]
+	return body, ok, nil
+}
+
+func (s *MemoryStore) Put(upstream string, date string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[cacheKey{upstream, date}] = body
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
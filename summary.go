@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// Statistics summarizes the values of a metric over a bucket. The standard
+// deviation is the population one and percentiles are linearly interpolated
+// between the closest ranks.
+type Statistics struct {
+	Min         float64            `json:"min"`
+	MinDate     string             `json:"min_date"`
+	Max         float64            `json:"max"`
+	MaxDate     string             `json:"max_date"`
+	Mean        float64            `json:"mean"`
+	Median      float64            `json:"median"`
+	StdDev      float64            `json:"stddev"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// SummaryBucket holds the statistics of every metric for the points between
+// Start and End, the dates of its first and last points.
+type SummaryBucket struct {
+	Start   string                `json:"start"`
+	End     string                `json:"end"`
+	Count   int                   `json:"count"`
+	Metrics map[string]Statistics `json:"metrics"`
+}
+
+type sample struct {
+	value float64
+	date  string
+}
+
+var defaultPercentiles = []float64{25, 75, 90}
+
+func (m *Module) GetTemperatureSummary(c echo.Context) error {
+	return m.serveSummary(c, m.fetchTemperature)
+}
+
+func (m *Module) GetSpeedSummary(c echo.Context) error {
+	return m.serveSummary(c, m.fetchSpeed)
+}
+
+func (m *Module) GetWeatherSummary(c echo.Context) error {
+	return m.serveSummary(c, m.fetchWeather)
+}
+
+// serveSummary answers the statistics of a range, as a single bucket or one
+// bucket per week or month with group_by.
+func (m *Module) serveSummary(c echo.Context, fetch dayFetcher) error {
+	page, err := getRangeFromRequest(c, m.ranges)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	if page.points() > m.ranges.MaxPoints {
+		return m.respondError(c, http.StatusBadRequest, &HttpError{http.StatusText(http.StatusBadRequest),
+			"Please provide a longer step or a shorter range, at most " + strconv.Itoa(m.ranges.MaxPoints) + " points are summarized at once"})
+	}
+	groupBy, err := getGroupByFromRequest(c)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	percentiles, err := getPercentilesFromRequest(c)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	units, err := getUnitsFromRequest(c, m.units)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	options := outputOptions{upstream: m.units, units: units}
+	ctx, cancel, err := getLookupContextFromRequest(c)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	defer cancel()
+
+	data, rangeErrors, err := m.fetchRange(ctx, page, fetch)
+	if err != nil {
+		return m.respondUnadmitted(c, err)
+	}
+	for i := range data {
+		data[i] = options.apply(data[i])
+	}
+	return respondRange(c, RangeResponse{summarize(data, groupBy, percentiles), rangeErrors, "", &units})
+}
+
+func getGroupByFromRequest(c echo.Context) (func(time.Time) time.Time, *HttpError) {
+	switch c.QueryParam("group_by") {
+	case "":
+		return nil, nil
+	case "week":
+		// The zero time is a Monday, so weeks start on Mondays.
+		return func(date time.Time) time.Time { return date.Truncate(time.Hour * 24 * 7) }, nil
+	case "month":
+		return func(date time.Time) time.Time {
+			return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}, nil
+	}
+	return nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide group_by as week or month"}
+}
+
+func getPercentilesFromRequest(c echo.Context) ([]float64, *HttpError) {
+	param := c.QueryParam("percentiles")
+	if param == "" {
+		return defaultPercentiles, nil
+	}
+
+	var percentiles []float64
+	for _, value := range strings.Split(param, ",") {
+		percentile, err := strconv.ParseFloat(value, 64)
+		if err != nil || percentile < 0 || percentile > 100 {
+			return nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide percentiles as comma separated numbers between 0 and 100 (eg. 5,50,95)"}
+		}
+		percentiles = append(percentiles, percentile)
+	}
+	return percentiles, nil
+}
+
+// summarize groups the observations, already ordered by date, into buckets.
+// Without groupBy every observation lands in a single bucket.
+func summarize(data []interface{}, groupBy func(time.Time) time.Time, percentiles []float64) []interface{} {
+	buckets := []interface{}{}
+	var bucket *SummaryBucket
+	var bucketKey time.Time
+	samples := make(map[string][]sample)
+
+	flush := func() {
+		if bucket == nil {
+			return
+		}
+		for metric, values := range samples {
+			bucket.Metrics[metric] = computeStatistics(values, percentiles)
+		}
+		buckets = append(buckets, *bucket)
+		samples = make(map[string][]sample)
+	}
+
+	for _, observation := range data {
+		date, metrics := observationMetrics(observation)
+		at, _ := time.Parse(time.RFC3339, date)
+
+		var key time.Time
+		if groupBy != nil {
+			key = groupBy(at)
+		}
+		if bucket == nil || !key.Equal(bucketKey) {
+			flush()
+			bucket = &SummaryBucket{Start: date, Metrics: make(map[string]Statistics)}
+			bucketKey = key
+		}
+
+		bucket.End = date
+		bucket.Count++
+		for metric, value := range metrics {
+			samples[metric] = append(samples[metric], sample{value, date})
+		}
+	}
+	flush()
+	return buckets
+}
+
+// observationMetrics returns the date and the summarized metrics of an
+// observation answered by a range endpoint.
+func observationMetrics(observation interface{}) (string, map[string]float64) {
+	switch o := observation.(type) {
+	case Temperature:
+		return o.Date, map[string]float64{"temp": o.Temp}
+	case Windspeed:
+		return o.Date, map[string]float64{"north": o.North, "west": o.West}
+	case Weather:
+		return o.Date, map[string]float64{"temp": o.Temp, "north": o.North, "west": o.West}
+	}
+	return "", nil
+}
+
+func computeStatistics(samples []sample, percentiles []float64) Statistics {
+	stats := Statistics{
+		Min:     samples[0].value,
+		MinDate: samples[0].date,
+		Max:     samples[0].value,
+		MaxDate: samples[0].date,
+	}
+
+	values := make([]float64, len(samples))
+	var sum float64
+	for i, s := range samples {
+		values[i] = s.value
+		sum += s.value
+		if s.value < stats.Min {
+			stats.Min, stats.MinDate = s.value, s.date
+		}
+		if s.value > stats.Max {
+			stats.Max, stats.MaxDate = s.value, s.date
+		}
+	}
+	stats.Mean = sum / float64(len(values))
+
+	var squares float64
+	for _, value := range values {
+		squares += (value - stats.Mean) * (value - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(squares / float64(len(values)))
+
+	sort.Float64s(values)
+	stats.Median = percentile(values, 50)
+	if len(percentiles) > 0 {
+		stats.Percentiles = make(map[string]float64)
+		for _, p := range percentiles {
+			stats.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(values, p)
+		}
+	}
+	return stats
+}
+
+// percentile interpolates the p-th percentile of values sorted in
+// ascending order.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
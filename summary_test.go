@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type SummaryTestSuite struct {
+	suite.Suite
+	temperatures []interface{}
+}
+
+func TestSummaryTestSuite(t *testing.T) {
+	suite.Run(t, new(SummaryTestSuite))
+}
+
+func (suite *SummaryTestSuite) SetupTest() {
+	suite.temperatures = []interface{}{
+		Temperature{Temp: 4, Date: "2018-07-30T00:00:00Z"},
+		Temperature{Temp: 2, Date: "2018-07-31T00:00:00Z"},
+		Temperature{Temp: 8, Date: "2018-08-01T00:00:00Z"},
+		Temperature{Temp: 6, Date: "2018-08-02T00:00:00Z"},
+	}
+}
+
+func (suite *SummaryTestSuite) TestSummarizeShouldComputeStatisticsOverTheWholeRange() {
+	// When
+	buckets := summarize(suite.temperatures, nil, []float64{25, 90})
+
+	// Then
+	assert.Equal(suite.T(), len(buckets), 1)
+	assert.DeepEqual(suite.T(), buckets[0], SummaryBucket{
+		Start: "2018-07-30T00:00:00Z",
+		End:   "2018-08-02T00:00:00Z",
+		Count: 4,
+		Metrics: map[string]Statistics{
+			"temp": {
+				Min:         2,
+				MinDate:     "2018-07-31T00:00:00Z",
+				Max:         8,
+				MaxDate:     "2018-08-01T00:00:00Z",
+				Mean:        5,
+				Median:      5,
+				StdDev:      2.23606797749979,
+				Percentiles: map[string]float64{"p25": 3.5, "p90": 7.4},
+			},
+		},
+	})
+}
+
+func (suite *SummaryTestSuite) TestSummarizeShouldGroupByMonth() {
+	// Given
+	groupBy := func(date time.Time) time.Time {
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// When
+	buckets := summarize(suite.temperatures, groupBy, nil)
+
+	// Then
+	assert.Equal(suite.T(), len(buckets), 2)
+	july := buckets[0].(SummaryBucket)
+	august := buckets[1].(SummaryBucket)
+	assert.Equal(suite.T(), july.Count, 2)
+	assert.Equal(suite.T(), july.End, "2018-07-31T00:00:00Z")
+	assert.Equal(suite.T(), july.Metrics["temp"].Mean, 3.0)
+	assert.Equal(suite.T(), august.Start, "2018-08-01T00:00:00Z")
+	assert.Equal(suite.T(), august.Metrics["temp"].Max, 8.0)
+}
+
+func (suite *SummaryTestSuite) TestSummarizeShouldGroupWeeksStartingOnMonday() {
+	// Given
+	groupBy := func(date time.Time) time.Time { return date.Truncate(time.Hour * 24 * 7) }
+	observations := append([]interface{}{Temperature{Temp: 1, Date: "2018-07-29T00:00:00Z"}}, suite.temperatures...)
+
+	// When
+	buckets := summarize(observations, groupBy, nil)
+
+	// Then
+	assert.Equal(suite.T(), len(buckets), 2)
+	assert.Equal(suite.T(), buckets[0].(SummaryBucket).Count, 1)
+	assert.Equal(suite.T(), buckets[1].(SummaryBucket).Start, "2018-07-30T00:00:00Z")
+}
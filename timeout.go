@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const timeoutHeader = "X-Request-Timeout"
+
+// getLookupContextFromRequest returns the context the days of a request are
+// looked up in. It is canceled as soon as the client disconnects and, given
+// timeout or the X-Request-Timeout header (eg. 5s), once the timeout elapsed.
+func getLookupContextFromRequest(c echo.Context) (context.Context, context.CancelFunc, *HttpError) {
+	value := c.QueryParam("timeout")
+	if value == "" {
+		value = c.Request().Header.Get(timeoutHeader)
+	}
+	if value == "" {
+		ctx, cancel := context.WithCancel(c.Request().Context())
+		return ctx, cancel, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return nil, nil, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a timeout such as 5s"}
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// contextError describes a lookup abandoned by its caller: past its deadline
+// it timed out, otherwise the client went away.
+func contextError(err error) *HttpError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &HttpError{http.StatusText(http.StatusGatewayTimeout), "Timed out waiting for the upstream"}
+	}
+	return &HttpError{clientClosedRequest, "Request canceled by the client"}
+}
+
+// respondUnadmitted answers a request the worker pool did not admit, either
+// because it is full or because the request timed out while queuing.
+func (m *Module) respondUnadmitted(c echo.Context, err *HttpError) error {
+	if err.Type == http.StatusText(http.StatusGatewayTimeout) {
+		return m.respondError(c, http.StatusGatewayTimeout, err)
+	}
+	c.Response().Header().Set("Retry-After", "1")
+	return m.respondError(c, http.StatusServiceUnavailable, err)
+}
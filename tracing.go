@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "charly.weather"
+	serviceName = "charly-weather"
+)
+
+func isTracingExporter(name string) bool {
+	return name == "" || name == "otlp" || name == "stdout"
+}
+
+// newTracerProvider exports spans as configured by tracing.exporter. Tracing
+// is disabled, returning nil, without an exporter or when it cannot be set
+// up. Incoming trace contexts are propagated in either case.
+func newTracerProvider(config TracingConfig, logger zerolog.Logger) *sdktrace.TracerProvider {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "":
+		return nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	if err != nil {
+		logger.Error().Msg("Failed to set up tracing: " + err.Error())
+		return nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// TraceRequests starts a server span for every request, continuing the trace
+// given in its traceparent header, and hands it to the handlers through the
+// request context.
+func TraceRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := tracer().Start(ctx, request.Method+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(request.Method),
+				semconv.HTTPRouteKey.String(c.Path()),
+				semconv.HTTPTargetKey.String(request.RequestURI),
+			),
+		)
+		defer span.End()
+
+		c.SetRequest(request.WithContext(ctx))
+		err := next(c)
+
+		status := responseStatus(c, err)
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+		return err
+	}
+}
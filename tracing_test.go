@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gotest.tools/assert"
+)
+
+type TracingTestSuite struct {
+	suite.Suite
+	recorder *tracetest.SpanRecorder
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
+
+func (suite *TracingTestSuite) SetupTest() {
+	suite.recorder = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(suite.recorder)))
+}
+
+func (suite *TracingTestSuite) TearDownTest() {
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+}
+
+func (suite *TracingTestSuite) TestRequestShouldBeTracedDownToTheUpstream() {
+	// Given
+	var mu sync.Mutex
+	traceparents := make(map[string]bool)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents[r.Header.Get("traceparent")] = true
+		mu.Unlock()
+		json, _ := json.Marshal(Temperature{Temp: 10, Date: r.URL.Query().Get("at")})
+		w.Write(json)
+	})
+	module := newTestModule(suite.T(), DefaultConfig())
+	module.temperatures = &GatewayModule{
+		baseURL:    "http://baseurl.com",
+		httpClient: &HttpClient{client: NewHttpClientForTesting(handler), logger: zerolog.Nop()},
+	}
+	router := echo.New()
+	router.Use(TraceRequests)
+	module.RegisterRoutes(router)
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T00:00:00Z&end=2018-08-02T00:00:00Z", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	// When
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	// Then
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range suite.recorder.Ended() {
+		assert.Equal(suite.T(), span.SpanContext().TraceID().String(), "0af7651916cd43dd8448eb211c80319c")
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	assert.Equal(suite.T(), len(spans["GET /temperatures"]), 1)
+	server := spans["GET /temperatures"][0]
+	assert.Equal(suite.T(), server.Parent().SpanID().String(), "b7ad6b7169203331")
+	assert.Equal(suite.T(), len(spans["day"]), 2)
+	days := make(map[trace.SpanID]bool)
+	for _, day := range spans["day"] {
+		assert.Equal(suite.T(), day.Parent().SpanID(), server.SpanContext().SpanID())
+		days[day.SpanContext().SpanID()] = true
+	}
+	assert.Equal(suite.T(), len(spans["HTTP GET"]), 2)
+	for _, client := range spans["HTTP GET"] {
+		assert.Equal(suite.T(), client.SpanKind(), trace.SpanKindClient)
+		assert.Assert(suite.T(), days[client.Parent().SpanID()])
+		assert.Assert(suite.T(), traceparents["00-0af7651916cd43dd8448eb211c80319c-"+client.SpanContext().SpanID().String()+"-01"])
+	}
+}
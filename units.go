@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// Units name the unit of the temperatures and of the wind speeds.
+type Units struct {
+	Temp string `json:"temp"`
+	Wind string `json:"wind"`
+}
+
+const (
+	celsius    = "C"
+	fahrenheit = "F"
+	kelvin     = "K"
+
+	metersPerSecond   = "m/s"
+	kilometersPerHour = "km/h"
+	milesPerHour      = "mph"
+	knots             = "kn"
+)
+
+// canonicalUnits are the units derived metrics are computed in.
+var canonicalUnits = Units{Temp: celsius, Wind: metersPerSecond}
+
+var unitSystems = map[string]Units{
+	"metric":   {Temp: celsius, Wind: metersPerSecond},
+	"imperial": {Temp: fahrenheit, Wind: milesPerHour},
+	"si":       {Temp: kelvin, Wind: metersPerSecond},
+}
+
+// windFactors convert a wind speed in the given unit to meters per second.
+var windFactors = map[string]float64{
+	metersPerSecond:   1,
+	kilometersPerHour: 1 / 3.6,
+	milesPerHour:      0.44704,
+	knots:             1852.0 / 3600,
+}
+
+var windAliases = map[string]string{"ms": metersPerSecond, "kmh": kilometersPerHour}
+
+// getUnitsFromRequest reads units as a system (metric, imperial or si) and
+// temp (C, F or K) and wind (m/s, km/h, mph or kn) overriding it per field.
+// Values keep the upstream units by default.
+func getUnitsFromRequest(c echo.Context, upstream Units) (Units, *HttpError) {
+	units := upstream
+	if system := c.QueryParam("units"); system != "" {
+		var ok bool
+		if units, ok = unitSystems[system]; !ok {
+			return units, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide units among metric, imperial, si"}
+		}
+	}
+
+	if temp := c.QueryParam("temp"); temp != "" {
+		if !isTemperatureUnit(temp) {
+			return units, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide temp among C, F, K"}
+		}
+		units.Temp = temp
+	}
+	if wind := c.QueryParam("wind"); wind != "" {
+		wind = normalizeWindUnit(wind)
+		if _, ok := windFactors[wind]; !ok {
+			return units, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide wind among m/s, km/h, mph, kn"}
+		}
+		units.Wind = wind
+	}
+	return units, nil
+}
+
+func isTemperatureUnit(unit string) bool {
+	return unit == celsius || unit == fahrenheit || unit == kelvin
+}
+
+func normalizeWindUnit(unit string) string {
+	if alias, ok := windAliases[unit]; ok {
+		return alias
+	}
+	return unit
+}
+
+func convertTemperature(value float64, from, to string) float64 {
+	if from == to {
+		return value
+	}
+
+	switch from {
+	case fahrenheit:
+		value = (value - 32) * 5 / 9
+	case kelvin:
+		value -= 273.15
+	}
+	switch to {
+	case fahrenheit:
+		return value*9/5 + 32
+	case kelvin:
+		return value + 273.15
+	}
+	return value
+}
+
+func convertWind(value float64, from, to string) float64 {
+	if from == to {
+		return value
+	}
+	return value * windFactors[from] / windFactors[to]
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type UnitsTestSuite struct {
+	suite.Suite
+}
+
+func TestUnitsTestSuite(t *testing.T) {
+	suite.Run(t, new(UnitsTestSuite))
+}
+
+func (suite *UnitsTestSuite) TestConvertTemperatureBetweenEveryUnit() {
+	assert.Equal(suite.T(), convertTemperature(100, celsius, fahrenheit), 212.0)
+	assert.Equal(suite.T(), convertTemperature(-40, fahrenheit, celsius), -40.0)
+	assert.Equal(suite.T(), convertTemperature(0, celsius, kelvin), 273.15)
+	assert.Equal(suite.T(), math.Round(convertTemperature(273.15, kelvin, fahrenheit)*100)/100, 32.0)
+}
+
+func (suite *UnitsTestSuite) TestConvertWindBetweenEveryUnit() {
+	assert.Equal(suite.T(), convertWind(10, metersPerSecond, kilometersPerHour), 36.0)
+	assert.Equal(suite.T(), math.Round(convertWind(1, knots, kilometersPerHour)*1000)/1000, 1.852)
+	assert.Equal(suite.T(), math.Round(convertWind(100, milesPerHour, metersPerSecond)*1000)/1000, 44.704)
+}
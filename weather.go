@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"os"
-	"sort"
 	"sync"
 	"time"
 
 	"github.com/labstack/echo"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Temperature struct {
@@ -21,6 +26,7 @@ type Windspeed struct {
 	North float64 `json:"north,omitempty"`
 	West  float64 `json:"west,omitempty"`
 	Date  string  `json:"date,omitempty"`
+	WindMetrics
 }
 
 type Weather struct {
@@ -28,225 +34,392 @@ type Weather struct {
 	West  float64 `json:"west,omitempty"`
 	Temp  float64 `json:"temp,omitempty"`
 	Date  string  `json:"date,omitempty"`
+	WindMetrics
+	ComfortMetrics
 }
 
+// RangeError describes an upstream failure for a single day of a range.
+type RangeError struct {
+	Date     string    `json:"date"`
+	Upstream string    `json:"upstream,omitempty"`
+	Error    HttpError `json:"error"`
+}
+
+// RangeResponse is the envelope answered by the range endpoints.
+type RangeResponse struct {
+	Data   []interface{} `json:"data"`
+	Errors []RangeError  `json:"errors"`
+	Next   string        `json:"next,omitempty"`
+	Units  *Units        `json:"units,omitempty"`
+}
+
+const (
+	dateLayout = "2006-01-02T15:04:05Z"
+
+	temperatureUpstream = "temperature"
+	windspeedUpstream   = "windspeed"
+)
+
 type Module struct {
 	logger       zerolog.Logger
 	temperatures Gateway
 	speeds       Gateway
+	breakers     map[string]*BreakerGateway
+	coalescers   map[string]*CoalescingGateway
+	pool         *WorkerPool
+	ranges       RangeSettings
+	units        Units
+	cache        *ResponseCache
+	store        Store
+	live         *LivePoller
+	liveSettings LiveSettings
+	alerts       *Alerts
+	metrics      *Metrics
+	tracing      *sdktrace.TracerProvider
+	httpClient   *HttpClient
+	gateways     map[string]*GatewayModule
+	probes       map[string]*Probe
+	reloadMu     sync.Mutex
+	config       Config
+	loadConfig   func() (Config, error)
+}
+
+// NewModule builds the module from a valid configuration. It fails when the
+// store cannot be opened.
+func NewModule(config Config) (*Module, error) {
+	logger := log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).Level(config.Level())
+	store, err := OpenStore(config.StorePath)
+	if err != nil {
+		return nil, fmt.Errorf("store_path: failed to open %s: %v", config.StorePath, err)
+	}
+	httpClient := NewHttpClient(config.HttpSettings(), DefaultRetryPolicy(), logger)
+	m := &Module{
+		logger:       logger,
+		breakers:     make(map[string]*BreakerGateway),
+		coalescers:   make(map[string]*CoalescingGateway),
+		pool:         NewWorkerPool(config.PoolSettings()),
+		ranges:       config.RangeSettings(),
+		cache:        NewResponseCache(config.CacheSettings()),
+		store:        store,
+		liveSettings: config.LiveSettings(),
+		metrics:      NewMetrics(),
+		tracing:      newTracerProvider(config.Tracing, logger),
+		httpClient:   httpClient,
+		config:       config,
+		loadConfig: func() (Config, error) {
+			return LoadConfig(os.Args[1:], os.Getenv)
+		},
+	}
+	temperatures := NewTemperatureGateway(config.Temperature, httpClient)
+	speeds := NewWindspeedGateway(config.Windspeed, httpClient)
+	m.gateways = map[string]*GatewayModule{temperatureUpstream: temperatures, windspeedUpstream: speeds}
+	m.probes = map[string]*Probe{
+		temperatureUpstream: NewProbe(temperatures, DefaultHealthSettings()),
+		windspeedUpstream:   NewProbe(speeds, DefaultHealthSettings()),
+	}
+	m.temperatures = m.stackGateway(temperatureUpstream, temperatures)
+	m.speeds = m.stackGateway(windspeedUpstream, speeds)
+	m.units = upstreamUnits(temperatures.Unit(), speeds.Unit(), logger)
+	// Observations of the current weather are neither cached nor stored.
+	m.live = NewLivePoller(m.liveSettings, m.coalescers[temperatureUpstream], m.coalescers[windspeedUpstream], logger)
+	m.alerts = NewAlerts(config.AlertSettings(), m.coalescers[temperatureUpstream], m.coalescers[windspeedUpstream], m.units, logger)
+	if path := config.Alerts.Path; path != "" {
+		if err := m.alerts.Load(path); err != nil {
+			logger.Error().Str("path", path).Msg("Failed to load alert rules: " + err.Error())
+		}
+	}
+	return m, nil
+}
+
+// upstreamUnits checks the units the upstreams report in, falling back to
+// the canonical ones when unknown.
+func upstreamUnits(temp string, wind string, logger zerolog.Logger) Units {
+	units := Units{Temp: temp, Wind: wind}
+	if !isTemperatureUnit(temp) {
+		logger.Error().Str("unit", temp).Msg("Unknown temperature upstream unit, assuming " + canonicalUnits.Temp)
+		units.Temp = canonicalUnits.Temp
+	}
+	if _, ok := windFactors[wind]; !ok {
+		logger.Error().Str("unit", wind).Msg("Unknown windspeed upstream unit, assuming " + canonicalUnits.Wind)
+		units.Wind = canonicalUnits.Wind
+	}
+	return units
+}
+
+// stackGateway wraps an upstream gateway with, from the outside in, the
+// response cache, the store, request coalescing, the circuit breaker and the
+// upstream metrics.
+func (m *Module) stackGateway(upstream string, gateway Gateway) Gateway {
+	breaker := NewBreakerGateway(upstream, NewMetricsGateway(upstream, gateway, m.metrics), m.config.BreakerSettings())
+	coalescing := NewCoalescingGateway(breaker)
+	m.breakers[upstream] = breaker
+	m.coalescers[upstream] = coalescing
+	return NewCachingGateway(upstream, NewStoreGateway(upstream, coalescing, m.store, m.logger), m.cache)
+}
+
+// Start runs the background work of the module, such as the evaluation of
+// the alert rules.
+func (m *Module) Start() {
+	m.alerts.Start()
 }
 
-func NewModule() *Module {
-	httpClient := NewHttpClient()
-	return &Module{
-		logger:       log.Output(zerolog.ConsoleWriter{Out: os.Stderr}),
-		temperatures: NewTemperatureGateway(httpClient),
-		speeds:       NewWindspeedGateway(httpClient),
+// Drain ends the live streams, which would otherwise never finish, so that
+// only the range requests are waited for when shutting down.
+func (m *Module) Drain() {
+	m.live.Close()
+}
+
+// Close stops the background work and releases the resources held by the
+// module, flushing the traces and closing the store.
+func (m *Module) Close() error {
+	m.live.Close()
+	m.alerts.Stop()
+	if m.tracing != nil {
+		if err := m.tracing.Shutdown(context.Background()); err != nil {
+			m.logger.Error().Msg("Failed to flush traces: " + err.Error())
+		}
 	}
+	return m.store.Close()
 }
 
 func (m *Module) RegisterRoutes(e *echo.Echo) {
 	e.GET("/temperatures", m.GetTemperature)
 	e.GET("/speeds", m.GetSpeed)
 	e.GET("/weather", m.GetWeather)
+	e.GET("/temperatures/summary", m.GetTemperatureSummary)
+	e.GET("/speeds/summary", m.GetSpeedSummary)
+	e.GET("/weather/summary", m.GetWeatherSummary)
+	e.GET("/weather/stream", m.StreamWeather)
+	e.GET("/weather/subscribe", m.SubscribeWeather)
+	e.GET("/alerts", m.GetAlerts, m.requireAdminToken)
+	e.POST("/alerts", m.CreateAlert, m.requireAdminToken)
+	e.GET("/alerts/:id", m.GetAlert, m.requireAdminToken)
+	e.PUT("/alerts/:id", m.UpdateAlert, m.requireAdminToken)
+	e.DELETE("/alerts/:id", m.DeleteAlert, m.requireAdminToken)
+	e.GET("/admin/breakers", m.GetBreakers, m.requireAdminToken)
+	e.GET("/admin/cache", m.GetCacheStats, m.requireAdminToken)
+	e.GET("/admin/coalescing", m.GetCoalescingStats, m.requireAdminToken)
+	e.POST("/admin/reload", m.ReloadConfig, m.requireAdminToken)
+	e.GET("/metrics", m.metrics.Handler())
+	e.GET("/healthz", m.GetHealth)
+	e.GET("/readyz", m.GetReadiness)
 }
 
 func (m *Module) GetTemperature(c echo.Context) error {
-	startDate, endDate, err := getStartdAndEndDateFromRequest(c)
-	if err != nil {
-		m.logger.Error().Msg(err.Type + " " + err.Message)
-		return c.JSON(http.StatusBadRequest, err)
-	}
-
-	var wg sync.WaitGroup
-	ch := make(chan Temperature)
-	errc := make(chan HttpError)
-	defer close(ch)
-	defer close(errc)
-
-	for !startDate.After(endDate) {
-		wg.Add(1)
-		go func(startDate time.Time) {
-			var temp Temperature
-			err := m.temperatures.GetResourceAt(startDate.Format("2006-01-02T15:04:05Z"), &temp)
-			if err != nil {
-				m.logger.Error().Msg(err.Type + " " + err.Message)
-				errc <- *err
-				return
-			}
-			ch <- temp
-		}(startDate)
-		startDate = startDate.Add(time.Hour * 24)
-	}
-
-	var temperatures []Temperature
-	go func() {
-		for temp := range ch {
-			temperatures = append(temperatures, temp)
-			wg.Done()
-		}
-	}()
+	return m.serveRange(c, m.fetchTemperature)
+}
 
-	var httpErros []HttpError
-	go func() {
-		for httpError := range errc {
-			httpErros = append(httpErros, httpError)
-			wg.Done()
-		}
-	}()
-	wg.Wait()
+func (m *Module) GetSpeed(c echo.Context) error {
+	return m.serveRange(c, m.fetchSpeed)
+}
 
-	if len(httpErros) > 0 {
-		return c.JSON(http.StatusInternalServerError, httpErros[0])
+func (m *Module) GetWeather(c echo.Context) error {
+	return m.serveRange(c, m.fetchWeather)
+}
+
+// GetBreakers reports the circuit breaker state of every upstream.
+func (m *Module) GetBreakers(c echo.Context) error {
+	statuses := make(map[string]BreakerStatus)
+	for name, gateway := range m.breakers {
+		statuses[name] = gateway.breaker.Status()
 	}
+	return c.JSON(http.StatusOK, statuses)
+}
 
-	sort.Slice(temperatures, func(i, j int) bool {
-		return temperatures[i].Date < temperatures[j].Date
-	})
-	return c.JSON(http.StatusOK, temperatures)
+// GetCacheStats reports the hits, misses and size of the response cache.
+func (m *Module) GetCacheStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, m.cache.Stats())
 }
 
-func (m *Module) GetSpeed(c echo.Context) error {
-	startDate, endDate, err := getStartdAndEndDateFromRequest(c)
-	if err != nil {
+// GetCoalescingStats reports, per upstream, how many lookups were made and
+// how many were served by a lookup already in flight.
+func (m *Module) GetCoalescingStats(c echo.Context) error {
+	stats := make(map[string]CoalescingStats)
+	for name, gateway := range m.coalescers {
+		stats[name] = gateway.Stats()
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// dayFetcher resolves a single date of a range. It returns either the
+// resolved value or the errors of every upstream that failed for that date.
+type dayFetcher func(ctx context.Context, date string) (interface{}, []RangeError)
+
+func (m *Module) fetchTemperature(ctx context.Context, date string) (interface{}, []RangeError) {
+	var temp Temperature
+	if err := m.temperatures.GetResourceAt(ctx, date, &temp); err != nil {
 		m.logger.Error().Msg(err.Type + " " + err.Message)
-		return c.JSON(http.StatusBadRequest, err)
-	}
-
-	var wg sync.WaitGroup
-	ch := make(chan Windspeed)
-	errc := make(chan HttpError)
-	defer close(ch)
-	defer close(errc)
-
-	for !startDate.After(endDate) {
-		wg.Add(1)
-		go func(startDate time.Time) {
-			var speed Windspeed
-			err := m.speeds.GetResourceAt(startDate.Format("2006-01-02T15:04:05Z"), &speed)
-			if err != nil {
-				m.logger.Error().Msg(err.Type + " " + err.Message)
-				errc <- *err
-				return
-			}
-			ch <- speed
-		}(startDate)
-		startDate = startDate.Add(time.Hour * 24)
-	}
-
-	var speeds []Windspeed
-	go func() {
-		for speed := range ch {
-			speeds = append(speeds, speed)
-			wg.Done()
-		}
-	}()
+		return nil, []RangeError{{date, temperatureUpstream, *err}}
+	}
+	return temp, nil
+}
 
-	var httpErros []HttpError
-	go func() {
-		for httpError := range errc {
-			httpErros = append(httpErros, httpError)
-			wg.Done()
-		}
-	}()
-	wg.Wait()
+func (m *Module) fetchSpeed(ctx context.Context, date string) (interface{}, []RangeError) {
+	var speed Windspeed
+	if err := m.speeds.GetResourceAt(ctx, date, &speed); err != nil {
+		m.logger.Error().Msg(err.Type + " " + err.Message)
+		return nil, []RangeError{{date, windspeedUpstream, *err}}
+	}
+	return speed, nil
+}
+
+func (m *Module) fetchWeather(ctx context.Context, date string) (interface{}, []RangeError) {
+	var rangeErrors []RangeError
 
-	if len(httpErros) > 0 {
-		return c.JSON(http.StatusInternalServerError, httpErros[0])
+	var speed Windspeed
+	if err := m.speeds.GetResourceAt(ctx, date, &speed); err != nil {
+		m.logger.Error().Msg(err.Type + " " + err.Message)
+		rangeErrors = append(rangeErrors, RangeError{date, windspeedUpstream, *err})
 	}
 
-	sort.Slice(speeds, func(i, j int) bool {
-		return speeds[i].Date < speeds[j].Date
-	})
-	return c.JSON(http.StatusOK, speeds)
+	var temp Temperature
+	if err := m.temperatures.GetResourceAt(ctx, date, &temp); err != nil {
+		m.logger.Error().Msg(err.Type + " " + err.Message)
+		rangeErrors = append(rangeErrors, RangeError{date, temperatureUpstream, *err})
+	}
+
+	if len(rangeErrors) > 0 {
+		return nil, rangeErrors
+	}
+
+	return Weather{
+		North: speed.North,
+		West:  speed.West,
+		Temp:  temp.Temp,
+		Date:  temp.Date,
+	}, nil
 }
 
-func (m *Module) GetWeather(c echo.Context) error {
-	startDate, endDate, err := getStartdAndEndDateFromRequest(c)
+// serveRange answers a range request, looking up each day with fetch.
+func (m *Module) serveRange(c echo.Context, fetch dayFetcher) error {
+	page, err := getRangeFromRequest(c, m.ranges)
+	if err == nil {
+		page, err = getPageFromRequest(c, page, m.ranges)
+	}
 	if err != nil {
-		m.logger.Error().Msg(err.Type + " " + err.Message)
-		return c.JSON(http.StatusBadRequest, err)
-	}
-
-	var wg sync.WaitGroup
-	ch := make(chan Weather)
-	errc := make(chan HttpError)
-	defer close(ch)
-	defer close(errc)
-
-	for !startDate.After(endDate) {
-		wg.Add(1)
-		go func(startDate time.Time) {
-			var httpErrors []HttpError
-
-			var speed Windspeed
-			if err := m.speeds.GetResourceAt(startDate.Format("2006-01-02T15:04:05Z"), &speed); err != nil {
-				m.logger.Error().Msg(err.Type + " " + err.Message)
-				httpErrors = append(httpErrors, *err)
-			}
-
-			var temp Temperature
-			if err := m.temperatures.GetResourceAt(startDate.Format("2006-01-02T15:04:05Z"), &temp); err != nil {
-				m.logger.Error().Msg(err.Type + " " + err.Message)
-				httpErrors = append(httpErrors, *err)
-			}
-
-			if len(httpErrors) > 0 {
-				errc <- httpErrors[0]
-				return
-			}
-
-			ch <- Weather{
-				North: speed.North,
-				West:  speed.West,
-				Temp:  temp.Temp,
-				Date:  temp.Date,
-			}
-		}(startDate)
-		startDate = startDate.Add(time.Hour * 24)
-	}
-
-	var weathers []Weather
-	go func() {
-		for weather := range ch {
-			weathers = append(weathers, weather)
-			wg.Done()
-		}
-	}()
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	options, err := getOutputOptionsFromRequest(c, m.units)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	format, err := getFormatFromRequest(c)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	ctx, cancel, err := getLookupContextFromRequest(c)
+	if err != nil {
+		return m.respondError(c, http.StatusBadRequest, err)
+	}
+	defer cancel()
+	if format == ndjsonFormat {
+		return m.streamNDJSON(ctx, c, page, fetch, options)
+	}
 
-	var httpErros []HttpError
-	go func() {
-		for httpError := range errc {
-			httpErros = append(httpErros, httpError)
-			wg.Done()
+	data, rangeErrors, err := m.fetchRange(ctx, page, fetch)
+	if err != nil {
+		return m.respondUnadmitted(c, err)
+	}
+	for i := range data {
+		data[i] = options.apply(data[i])
+	}
+	response := RangeResponse{data, rangeErrors, page.next, &options.units}
+	if format == csvFormat && !rangeFailed(c, response) {
+		return respondCSV(c, page, response, options)
+	}
+	return respondRange(c, response)
+}
+
+// fetchRange resolves every point of the page on the worker pool. The
+// resolved values and the errors are both returned ordered by date. It fails
+// when the pool has no room left for the request.
+func (m *Module) fetchRange(ctx context.Context, page rangePage, fetch dayFetcher) ([]interface{}, []RangeError, *HttpError) {
+	data := []interface{}{}
+	rangeErrors := []RangeError{}
+	err := m.streamRange(ctx, page, fetch, func(value interface{}, dayErrors []RangeError) {
+		if len(dayErrors) > 0 {
+			rangeErrors = append(rangeErrors, dayErrors...)
+			return
 		}
-	}()
-	wg.Wait()
+		data = append(data, value)
+	})
+	return data, rangeErrors, err
+}
+
+// streamRange resolves every point of the page on the worker pool and calls
+// emit, in date order, as soon as a point and every point before it resolved.
+// Once ctx is done the points not looked up yet are skipped, and reported
+// with the error of ctx but no upstream.
+// It fails when the pool has no room left for the request, or when ctx is
+// done before the request got any.
+func (m *Module) streamRange(ctx context.Context, page rangePage, fetch dayFetcher, emit func(value interface{}, dayErrors []RangeError)) *HttpError {
+	var dates []time.Time
+	for date := page.start; !date.After(page.end); date = date.Add(page.step) {
+		dates = append(dates, date)
+	}
 
-	if len(httpErros) > 0 {
-		return c.JSON(http.StatusInternalServerError, httpErros[0])
+	if len(dates) > 0 && !m.pool.Admit(ctx) {
+		if ctx.Err() != nil {
+			return contextError(ctx.Err())
+		}
+		return &HttpError{http.StatusText(http.StatusServiceUnavailable), "Too many requests in progress, please retry later"}
 	}
 
-	sort.Slice(weathers, func(i, j int) bool {
-		return weathers[i].Date < weathers[j].Date
+	values := make([]interface{}, len(dates))
+	dayErrors := make([][]RangeError, len(dates))
+	resolved := make(chan int, len(dates))
+	go m.pool.Run(ctx, len(dates), func(i int) {
+		date := dates[i].Format(dateLayout)
+		dayCtx, span := tracer().Start(ctx, "day", trace.WithAttributes(attribute.String("date", date)))
+		m.metrics.inflightDays.Inc()
+		values[i], dayErrors[i] = fetch(dayCtx, date)
+		m.metrics.inflightDays.Dec()
+		if len(dayErrors[i]) > 0 {
+			span.SetStatus(codes.Error, dayErrors[i][0].Error.Type+" "+dayErrors[i][0].Error.Message)
+		}
+		span.End()
+		resolved <- i
+	}, func(i int) {
+		dayErrors[i] = []RangeError{{Date: dates[i].Format(dateLayout), Error: *contextError(ctx.Err())}}
+		resolved <- i
 	})
-	return c.JSON(http.StatusOK, weathers)
-}
 
-func getStartdAndEndDateFromRequest(c echo.Context) (time.Time, time.Time, *HttpError) {
-	start := c.QueryParam("start")
-	end := c.QueryParam("end")
-	if start == "" || end == "" {
-		return time.Now(), time.Now(), &HttpError{http.StatusText(http.StatusBadRequest), "Please provide both start and end dates"}
+	done := make([]bool, len(dates))
+	next := 0
+	for range dates {
+		done[<-resolved] = true
+		for next < len(dates) && done[next] {
+			emit(values[next], dayErrors[next])
+			next++
+		}
 	}
+	return nil
+}
 
-	startDate, startErr := time.Parse("2006-01-02T15:04:05Z", start)
-	endDate, err := time.Parse("2006-01-02T15:04:05Z", end)
-	if startErr != nil || err != nil {
-		return time.Now(), time.Now(), &HttpError{http.StatusText(http.StatusBadRequest), "Please provide dates with format ISO8601 DateTime (eg. 2018-08-12T12:00:00Z)"}
+func (m *Module) respondError(c echo.Context, status int, err *HttpError) error {
+	m.logger.Error().Msg(err.Type + " " + err.Message)
+	return c.JSON(status, err)
+}
+
+// respondRange writes the envelope of a range request. In strict mode any
+// failure answers with the first error only, otherwise the days that resolved
+// are returned along with the failures and the link to the next page. A range
+// where no day resolved is still answered as an internal server error.
+func respondRange(c echo.Context, response RangeResponse) error {
+	if !rangeFailed(c, response) {
+		return c.JSON(http.StatusOK, response)
+	}
+	if c.QueryParam("strict") == "true" {
+		return c.JSON(http.StatusInternalServerError, response.Errors[0].Error)
 	}
+	return c.JSON(http.StatusInternalServerError, response)
+}
 
-	startDate = startDate.Truncate(24 * time.Hour)
-	endDate = endDate.Truncate(24 * time.Hour)
-	return startDate, endDate, nil
+// rangeFailed reports whether a range is answered as an internal server
+// error, either because of a failure in strict mode or because no day resolved.
+func rangeFailed(c echo.Context, response RangeResponse) bool {
+	if len(response.Errors) == 0 {
+		return false
+	}
+	return c.QueryParam("strict") == "true" || len(response.Data) == 0
 }
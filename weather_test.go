@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/suite"
@@ -22,8 +25,15 @@ func TestWeatherTestSuite(t *testing.T) {
 	suite.Run(t, new(WeatherTestSuite))
 }
 
+// newTestModule builds a module from config, failing the test otherwise.
+func newTestModule(t *testing.T, config Config) *Module {
+	module, err := NewModule(config)
+	assert.NilError(t, err)
+	return module
+}
+
 func (suite *WeatherTestSuite) SetupTest() {
-	suite.module = NewModule()
+	suite.module = newTestModule(suite.T(), DefaultConfig())
 	suite.echo = echo.New()
 	suite.module.RegisterRoutes(suite.echo)
 	suite.populateModuleWithFakeData()
@@ -39,16 +49,17 @@ func (suite *WeatherTestSuite) TestGetTemperaturesOrderedByDate() {
 	err := suite.module.GetTemperature(context)
 
 	// Then
-	var temps []Temperature
+	var response temperaturesResponse
 	assert.NilError(suite.T(), err)
 	assert.Equal(suite.T(), rec.Code, http.StatusOK)
-	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &temps))
-	assert.Equal(suite.T(), len(temps), 2)
-	assert.DeepEqual(suite.T(), temps[0], Temperature{
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.Equal(suite.T(), len(response.Errors), 0)
+	assert.DeepEqual(suite.T(), response.Data[0], Temperature{
 		Temp: 10.5353456000000,
 		Date: "2018-08-01T00:00:00Z",
 	})
-	assert.DeepEqual(suite.T(), temps[1], Temperature{
+	assert.DeepEqual(suite.T(), response.Data[1], Temperature{
 		Temp: 13.5353456555445,
 		Date: "2018-08-02T00:00:00Z",
 	})
@@ -134,9 +145,44 @@ func (suite *WeatherTestSuite) TestGetTemperatureReturnBadRequestWhenEndDateIsMa
 	})
 }
 
-func (suite *WeatherTestSuite) TestGetTemperatureReturnInternalServerErrorWhenDataIsNotFound() {
+func (suite *WeatherTestSuite) TestGetTemperatureReturnBadRequestPastTheConfiguredPoints() {
 	// Given
-	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	config := DefaultConfig()
+	config.Ranges.MaxPoints = 2
+	suite.module = newTestModule(suite.T(), config)
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T00:00:00Z&end=2018-08-03T00:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.Equal(suite.T(), httpError.Message, "Please provide a limit, a longer step or a shorter range, at most 2 points are answered at once")
+}
+
+func (suite *WeatherTestSuite) TestNewModuleShouldApplyTheConfiguredBreakerAndCache() {
+	// Given
+	config := DefaultConfig()
+	config.Breaker.FailureThreshold = 2
+	config.Cache.TTL = Duration(time.Second)
+
+	// When
+	module := newTestModule(suite.T(), config)
+
+	// Then
+	assert.Equal(suite.T(), module.breakers[temperatureUpstream].breaker.settings, config.BreakerSettings())
+	assert.Equal(suite.T(), module.breakers[windspeedUpstream].breaker.settings, config.BreakerSettings())
+	assert.Equal(suite.T(), module.cache.settings, config.CacheSettings())
+}
+
+func (suite *WeatherTestSuite) TestGetTemperatureReturnInternalServerErrorWhenDataIsNotFoundInStrictMode() {
+	// Given
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z&strict=true", nil)
 	rec := httptest.NewRecorder()
 	context := suite.echo.NewContext(req, rec)
 
@@ -164,17 +210,18 @@ func (suite *WeatherTestSuite) TestGetSpeedsOrderedByDate() {
 	err := suite.module.GetSpeed(context)
 
 	// Then
-	var speeds []Windspeed
+	var response speedsResponse
 	assert.NilError(suite.T(), err)
 	assert.Equal(suite.T(), rec.Code, http.StatusOK)
-	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &speeds))
-	assert.Equal(suite.T(), len(speeds), 2)
-	assert.DeepEqual(suite.T(), speeds[0], Windspeed{
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.Equal(suite.T(), len(response.Errors), 0)
+	assert.DeepEqual(suite.T(), response.Data[0], Windspeed{
 		North: 9.5353456087290,
 		West:  -13.5353456037382,
 		Date:  "2018-08-01T00:00:00Z",
 	})
-	assert.DeepEqual(suite.T(), speeds[1], Windspeed{
+	assert.DeepEqual(suite.T(), response.Data[1], Windspeed{
 		North: 10.5353456026384,
 		West:  -15.5353456074028,
 		Date:  "2018-08-02T00:00:00Z",
@@ -261,9 +308,9 @@ func (suite *WeatherTestSuite) TestGetSpeedReturnBadRequestWhenEndDateIsMalforme
 	})
 }
 
-func (suite *WeatherTestSuite) TestGetSpeedReturnInternalServerErrorWhenDataIsNotFound() {
+func (suite *WeatherTestSuite) TestGetSpeedReturnInternalServerErrorWhenDataIsNotFoundInStrictMode() {
 	// Given
-	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z&strict=true", nil)
 	rec := httptest.NewRecorder()
 	context := suite.echo.NewContext(req, rec)
 
@@ -291,18 +338,19 @@ func (suite *WeatherTestSuite) TestGetWeathersOrderedByDate() {
 	err := suite.module.GetWeather(context)
 
 	// Then
-	var weathers []Weather
+	var response weathersResponse
 	assert.NilError(suite.T(), err)
 	assert.Equal(suite.T(), rec.Code, http.StatusOK)
-	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &weathers))
-	assert.Equal(suite.T(), len(weathers), 2)
-	assert.DeepEqual(suite.T(), weathers[0], Weather{
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.Equal(suite.T(), len(response.Errors), 0)
+	assert.DeepEqual(suite.T(), response.Data[0], Weather{
 		North: 9.5353456087290,
 		West:  -13.5353456037382,
 		Temp:  10.5353456000000,
 		Date:  "2018-08-01T00:00:00Z",
 	})
-	assert.DeepEqual(suite.T(), weathers[1], Weather{
+	assert.DeepEqual(suite.T(), response.Data[1], Weather{
 		North: 10.5353456026384,
 		West:  -15.5353456074028,
 		Temp:  13.5353456555445,
@@ -390,9 +438,9 @@ func (suite *WeatherTestSuite) TestGetWeatherReturnBadRequestWhenEndDateIsMalfor
 	})
 }
 
-func (suite *WeatherTestSuite) TestGetWeatherReturnInternalServerErrorWhenDataIsNotFound() {
+func (suite *WeatherTestSuite) TestGetWeatherReturnInternalServerErrorWhenDataIsNotFoundInStrictMode() {
 	// Given
-	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z&strict=true", nil)
 	rec := httptest.NewRecorder()
 	context := suite.echo.NewContext(req, rec)
 
@@ -410,6 +458,727 @@ func (suite *WeatherTestSuite) TestGetWeatherReturnInternalServerErrorWhenDataIs
 	})
 }
 
+func (suite *WeatherTestSuite) TestGetTemperatureReturnPartialResultsWhenDataIsNotFound() {
+	// Given
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	var response temperaturesResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.DeepEqual(suite.T(), response.Errors, []RangeError{{
+		Date:     "2018-08-03T00:00:00Z",
+		Upstream: "temperature",
+		Error: HttpError{
+			Type:    http.StatusText(http.StatusNotFound),
+			Message: "Resource not found for 2018-08-03T00:00:00Z",
+		},
+	}})
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedReturnPartialResultsWhenDataIsNotFound() {
+	// Given
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var response speedsResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.DeepEqual(suite.T(), response.Errors, []RangeError{{
+		Date:     "2018-08-03T00:00:00Z",
+		Upstream: "windspeed",
+		Error: HttpError{
+			Type:    http.StatusText(http.StatusNotFound),
+			Message: "Resource not found for 2018-08-03T00:00:00Z",
+		},
+	}})
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnPartialResultsWithEveryFailedUpstream() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var response weathersResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.DeepEqual(suite.T(), response.Errors, []RangeError{
+		{
+			Date:     "2018-08-03T00:00:00Z",
+			Upstream: "windspeed",
+			Error: HttpError{
+				Type:    http.StatusText(http.StatusNotFound),
+				Message: "Resource not found for 2018-08-03T00:00:00Z",
+			},
+		},
+		{
+			Date:     "2018-08-03T00:00:00Z",
+			Upstream: "temperature",
+			Error: HttpError{
+				Type:    http.StatusText(http.StatusNotFound),
+				Message: "Resource not found for 2018-08-03T00:00:00Z",
+			},
+		},
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnInternalServerErrorWhenNoDayIsFound() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-09-01T12:00:00Z&end=2018-09-02T11:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var response weathersResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusInternalServerError)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 0)
+	assert.Equal(suite.T(), len(response.Errors), 4)
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnServiceUnavailableWhenPoolIsExhausted() {
+	// Given
+	suite.module.pool = NewWorkerPool(PoolSettings{PerRequest: 1, Global: 1, QueueTimeout: time.Millisecond})
+	suite.module.pool.Admit(context.Background())
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusServiceUnavailable)
+	assert.Equal(suite.T(), rec.Header().Get("Retry-After"), "1")
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusServiceUnavailable),
+		Message: "Too many requests in progress, please retry later",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetTemperatureReturnPartialResultsWhenTimeoutElapses() {
+	// Given
+	suite.module.temperatures = &delayedGatewayMock{
+		gateway: suite.module.temperatures,
+		delays:  map[string]time.Duration{"2018-08-02T00:00:00Z": time.Minute},
+	}
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&timeout=20ms", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	var response temperaturesResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 1)
+	assert.DeepEqual(suite.T(), response.Errors, []RangeError{{
+		Date:     "2018-08-02T00:00:00Z",
+		Upstream: temperatureUpstream,
+		Error:    HttpError{http.StatusText(http.StatusGatewayTimeout), "Timed out waiting for the upstream"},
+	}})
+}
+
+func (suite *WeatherTestSuite) TestGetTemperatureShouldSkipTheDaysLeftOnceTimedOut() {
+	// Given
+	delays := make(map[string]time.Duration)
+	start := time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		delays[start.AddDate(0, 0, i).Format(dateLayout)] = time.Millisecond * 10
+	}
+	upstream := &countingGatewayMock{gateway: &delayedGatewayMock{gateway: suite.module.temperatures, delays: delays}}
+	suite.module.temperatures = upstream
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T00:00:00Z&end="+start.AddDate(0, 0, 999).Format(dateLayout)+"&timeout=50ms", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	var response temperaturesResponse
+	assert.NilError(suite.T(), err)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Assert(suite.T(), upstream.Calls() < 100)
+	assert.Equal(suite.T(), len(response.Data)+len(response.Errors), 1000)
+	assert.DeepEqual(suite.T(), response.Errors[len(response.Errors)-1], RangeError{
+		Date:  "2021-04-26T00:00:00Z",
+		Error: HttpError{http.StatusText(http.StatusGatewayTimeout), "Timed out waiting for the upstream"},
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetTemperatureReturnBadRequestWhenTimeoutIsMalformed() {
+	// Given
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z", nil)
+	req.Header.Set(timeoutHeader, "soon")
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide a timeout such as 5s",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnBadRequestWhenEndDateIsBeforeStartDate() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-02T12:00:00Z&end=2018-08-01T12:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide an end date after the start date",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnBadRequestWhenRangeIsTooLong() {
+	// Given
+	suite.module.ranges.MaxSpan = time.Hour * 24 * 30
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-09-01T12:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide a range of at most 30 days",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnFirstPageWithNextLink() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z&limit=1", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var response weathersResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 1)
+	assert.Equal(suite.T(), response.Data[0].Date, "2018-08-01T00:00:00Z")
+	assert.Equal(suite.T(), response.Next,
+		"/weather?end=2018-08-03T11%3A00%3A00Z&limit=1&page_token=MjAxOC0wOC0wMlQwMDowMDowMFo&start=2018-08-01T12%3A00%3A00Z")
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnLastPageWithoutNextLink() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&limit=5&page_token=MjAxOC0wOC0wMlQwMDowMDowMFo", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var response weathersResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 1)
+	assert.Equal(suite.T(), response.Data[0].Date, "2018-08-02T00:00:00Z")
+	assert.Equal(suite.T(), response.Next, "")
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnBadRequestWhenPageTokenIsOutOfRange() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&limit=1&page_token=MjAxOC0wOS0wMlQwMDowMDowMFo", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide a page_token returned by a previous page",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedsEveryStepAlignedToTheStep() {
+	// Given
+	suite.module.speeds = &WindspeedGatewayMock{
+		speeds: map[string]Windspeed{
+			"2018-08-01T00:00:00Z": {North: 1, West: 1, Date: "2018-08-01T00:00:00Z"},
+			"2018-08-01T06:00:00Z": {North: 2, West: 2, Date: "2018-08-01T06:00:00Z"},
+			"2018-08-01T12:00:00Z": {North: 3, West: 3, Date: "2018-08-01T12:00:00Z"},
+		},
+	}
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T01:30:00Z&end=2018-08-01T12:10:00Z&step=6h", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var response speedsResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Errors), 0)
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.Equal(suite.T(), response.Data[0].Date, "2018-08-01T06:00:00Z")
+	assert.Equal(suite.T(), response.Data[1].Date, "2018-08-01T12:00:00Z")
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedsEveryStepNeverBeforeTheStartDate() {
+	// Given
+	suite.module.speeds = &WindspeedGatewayMock{
+		speeds: map[string]Windspeed{
+			"2018-08-01T00:00:00Z": {North: 1, West: 1, Date: "2018-08-01T00:00:00Z"},
+			"2018-08-01T05:00:00Z": {North: 2, West: 2, Date: "2018-08-01T05:00:00Z"},
+			"2018-08-01T10:00:00Z": {North: 3, West: 3, Date: "2018-08-01T10:00:00Z"},
+			"2018-08-08T00:00:00Z": {North: 4, West: 4, Date: "2018-08-08T00:00:00Z"},
+			"2018-08-15T00:00:00Z": {North: 5, West: 5, Date: "2018-08-15T00:00:00Z"},
+		},
+	}
+	weekly := httptest.NewRequest("GET", "/speeds?start=2018-08-01T00:00:00Z&end=2018-08-15T00:00:00Z&step=1w", nil)
+	hourly := httptest.NewRequest("GET", "/speeds?start=2018-08-01T00:00:00Z&end=2018-08-01T12:00:00Z&step=5h", nil)
+	weeklyRec := httptest.NewRecorder()
+	hourlyRec := httptest.NewRecorder()
+
+	// When
+	weeklyErr := suite.module.GetSpeed(suite.echo.NewContext(weekly, weeklyRec))
+	hourlyErr := suite.module.GetSpeed(suite.echo.NewContext(hourly, hourlyRec))
+
+	// Then
+	var weeks, hours speedsResponse
+	assert.NilError(suite.T(), weeklyErr)
+	assert.NilError(suite.T(), hourlyErr)
+	assert.NilError(suite.T(), json.Unmarshal(weeklyRec.Body.Bytes(), &weeks))
+	assert.NilError(suite.T(), json.Unmarshal(hourlyRec.Body.Bytes(), &hours))
+	assert.Equal(suite.T(), len(weeks.Errors), 0)
+	assert.DeepEqual(suite.T(), []string{weeks.Data[0].Date, weeks.Data[1].Date, weeks.Data[2].Date},
+		[]string{"2018-08-01T00:00:00Z", "2018-08-08T00:00:00Z", "2018-08-15T00:00:00Z"})
+	assert.Equal(suite.T(), len(hours.Errors), 0)
+	assert.DeepEqual(suite.T(), []string{hours.Data[0].Date, hours.Data[1].Date, hours.Data[2].Date},
+		[]string{"2018-08-01T00:00:00Z", "2018-08-01T05:00:00Z", "2018-08-01T10:00:00Z"})
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedsEveryStepFromTheExactStartDate() {
+	// Given
+	suite.module.speeds = &WindspeedGatewayMock{
+		speeds: map[string]Windspeed{
+			"2018-08-01T01:30:00Z": {North: 1, West: 1, Date: "2018-08-01T01:30:00Z"},
+			"2018-08-01T07:30:00Z": {North: 2, West: 2, Date: "2018-08-01T07:30:00Z"},
+		},
+	}
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T01:30:00Z&end=2018-08-01T12:10:00Z&step=6h&truncate=false", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var response speedsResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Errors), 0)
+	assert.Equal(suite.T(), len(response.Data), 2)
+	assert.Equal(suite.T(), response.Data[0].Date, "2018-08-01T01:30:00Z")
+	assert.Equal(suite.T(), response.Data[1].Date, "2018-08-01T07:30:00Z")
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedReturnBadRequestWhenStepIsMalformed() {
+	// Given
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&step=1y", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide a step of at least one minute (eg. 1h, 6h, 1d, 1w)",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedReturnBadRequestWhenStepOverflows() {
+	// Given
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&step=30501w", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.Equal(suite.T(), httpError.Message, "Please provide a step of at least one minute (eg. 1h, 6h, 1d, 1w)")
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherSummaryOverTheRange() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather/summary?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&percentiles=50", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeatherSummary(context)
+
+	// Then
+	var response struct {
+		Data   []SummaryBucket `json:"data"`
+		Errors []RangeError    `json:"errors"`
+	}
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 1)
+	assert.Equal(suite.T(), response.Data[0].Count, 2)
+	assert.Equal(suite.T(), response.Data[0].Metrics["temp"].MaxDate, "2018-08-02T00:00:00Z")
+	assert.Equal(suite.T(), response.Data[0].Metrics["west"].Min, -15.5353456074028)
+	assert.Equal(suite.T(), response.Data[0].Metrics["north"].Percentiles["p50"], response.Data[0].Metrics["north"].Median)
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherSummaryReturnBadRequestWhenGroupByIsUnknown() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather/summary?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&group_by=year", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeatherSummary(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide group_by as week or month",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedsWithDerivedWindMetrics() {
+	// Given
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-01T12:00:00Z&include=derived", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var response speedsResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 1)
+	assert.Equal(suite.T(), *response.Data[0].Magnitude, 16.55682326083547)
+	assert.Equal(suite.T(), response.Data[0].Compass, "SW")
+	assert.Equal(suite.T(), *response.Data[0].Beaufort, 7)
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnBadRequestWhenFieldIsUnknown() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&fields=gust", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide fields among magnitude, direction, compass, beaufort",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetWeathersWithComfortIndices() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-01T12:00:00Z&include=comfort", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var response weathersResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), len(response.Data), 1)
+	assert.Assert(suite.T(), response.Data[0].WindChill == nil)
+	assert.Equal(suite.T(), *response.Data[0].ApparentTemp, 10.5353456000000)
+}
+
+func (suite *WeatherTestSuite) TestGetTemperaturesInRequestedUnits() {
+	// Given
+	suite.module.units = Units{Temp: kelvin, Wind: metersPerSecond}
+	suite.module.temperatures = &TemperatureGatewayMock{
+		temperatures: map[string]Temperature{
+			"2018-08-01T00:00:00Z": {Temp: 283.15, Date: "2018-08-01T00:00:00Z"},
+		},
+	}
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-01T12:00:00Z&units=imperial", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	var response temperaturesResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), response.Data[0].Temp, 50.0)
+	assert.DeepEqual(suite.T(), *response.Units, Units{Temp: fahrenheit, Wind: milesPerHour})
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedsInUnitsPickedPerField() {
+	// Given
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-01T12:00:00Z&units=imperial&wind=kmh", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var response speedsResponse
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(suite.T(), response.Data[0].North, 9.5353456087290*3.6)
+	assert.DeepEqual(suite.T(), *response.Units, Units{Temp: fahrenheit, Wind: kilometersPerHour})
+}
+
+func (suite *WeatherTestSuite) TestGetWeatherReturnBadRequestWhenUnitIsUnknown() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&temp=R", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide temp among C, F, K",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetWeathersAsCSVWhenAccepted() {
+	// Given
+	req := httptest.NewRequest("GET", "/weather?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&include=comfort", nil)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetWeather(context)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.Equal(suite.T(), rec.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+	assert.Equal(suite.T(), rec.Header().Get("Content-Disposition"), `attachment; filename="weather_2018-08-01_2018-08-02.csv"`)
+	assert.Equal(suite.T(), rec.Body.String(), "north,west,temp,date,wind_chill,apparent_temp\r\n"+
+		"9.535345608729,-13.5353456037382,10.5353456,2018-08-01T00:00:00Z,,10.5353456\r\n"+
+		"10.5353456026384,-15.5353456074028,13.5353456555445,2018-08-02T00:00:00Z,,13.5353456555445\r\n")
+}
+
+func (suite *WeatherTestSuite) TestGetTemperaturesAsCSVWithFormatParameter() {
+	// Given
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z&format=csv", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.Equal(suite.T(), rec.Header().Get("Content-Disposition"), `attachment; filename="temperatures_2018-08-01_2018-08-03.csv"`)
+	assert.Equal(suite.T(), rec.Header().Get("X-Error-Count"), "1")
+	assert.Equal(suite.T(), rec.Body.String(), "temp,date\r\n"+
+		"10.5353456,2018-08-01T00:00:00Z\r\n"+
+		"13.5353456555445,2018-08-02T00:00:00Z\r\n"+
+		"\r\n"+
+		"date,upstream,type,message\r\n"+
+		"2018-08-03T00:00:00Z,temperature,Not Found,Resource not found for 2018-08-03T00:00:00Z\r\n")
+}
+
+func (suite *WeatherTestSuite) TestGetTemperaturesAsCSVShouldLinkTheNextPage() {
+	// Given
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&limit=1&format=csv", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.Equal(suite.T(), rec.Header().Get("X-Error-Count"), "0")
+	assert.Equal(suite.T(), rec.Header().Get("Link"),
+		`</temperatures?end=2018-08-02T11%3A00%3A00Z&format=csv&limit=1&page_token=MjAxOC0wOC0wMlQwMDowMDowMFo&start=2018-08-01T12%3A00%3A00Z>; rel="next"`)
+	assert.Equal(suite.T(), rec.Body.String(), "temp,date\r\n"+
+		"10.5353456,2018-08-01T00:00:00Z\r\n")
+}
+
+func (suite *WeatherTestSuite) TestGetSpeedReturnBadRequestWhenFormatIsUnknown() {
+	// Given
+	req := httptest.NewRequest("GET", "/speeds?start=2018-08-01T12:00:00Z&end=2018-08-02T11:00:00Z&format=xml", nil)
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetSpeed(context)
+
+	// Then
+	var httpError HttpError
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusBadRequest)
+	assert.NilError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &httpError))
+	assert.DeepEqual(suite.T(), httpError, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide format among json, csv, ndjson",
+	})
+}
+
+func (suite *WeatherTestSuite) TestGetTemperaturesAsNDJSONStreamEndingWithTrailer() {
+	// Given
+	req := httptest.NewRequest("GET", "/temperatures?start=2018-08-01T12:00:00Z&end=2018-08-03T11:00:00Z", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	context := suite.echo.NewContext(req, rec)
+
+	// When
+	err := suite.module.GetTemperature(context)
+
+	// Then
+	assert.NilError(suite.T(), err)
+	assert.Equal(suite.T(), rec.Code, http.StatusOK)
+	assert.Equal(suite.T(), rec.Header().Get("Content-Type"), "application/x-ndjson")
+	assert.Assert(suite.T(), rec.Flushed)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	assert.Equal(suite.T(), len(lines), 3)
+	assert.Equal(suite.T(), lines[0], `{"temp":10.5353456,"date":"2018-08-01T00:00:00Z"}`)
+	assert.Equal(suite.T(), lines[1], `{"temp":13.5353456555445,"date":"2018-08-02T00:00:00Z"}`)
+	var trailer StreamTrailer
+	assert.NilError(suite.T(), json.Unmarshal([]byte(lines[2]), &trailer))
+	assert.Assert(suite.T(), trailer.Trailer)
+	assert.Equal(suite.T(), trailer.Count, 2)
+	assert.Equal(suite.T(), len(trailer.Errors), 1)
+	assert.Equal(suite.T(), trailer.Errors[0].Date, "2018-08-03T00:00:00Z")
+}
+
+func (suite *WeatherTestSuite) TestStreamRangeEmitsInDateOrderWhenLaterDaysResolveFirst() {
+	// Given
+	suite.module.temperatures = &delayedGatewayMock{
+		gateway: suite.module.temperatures,
+		delays:  map[string]time.Duration{"2018-08-01T00:00:00Z": time.Millisecond * 20},
+	}
+	page := rangePage{
+		start: time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC),
+		end:   time.Date(2018, 8, 2, 0, 0, 0, 0, time.UTC),
+		step:  time.Hour * 24,
+	}
+
+	// When
+	var dates []string
+	err := suite.module.streamRange(context.Background(), page, suite.module.fetchTemperature, func(value interface{}, dayErrors []RangeError) {
+		dates = append(dates, value.(Temperature).Date)
+	})
+
+	// Then
+	assert.Assert(suite.T(), err == nil)
+	assert.DeepEqual(suite.T(), dates, []string{"2018-08-01T00:00:00Z", "2018-08-02T00:00:00Z"})
+}
+
 func (suite *WeatherTestSuite) populateModuleWithFakeData() {
 	windspeeds := make(map[string]Windspeed)
 	windspeeds["2018-08-02T00:00:00Z"] = Windspeed{
@@ -444,7 +1213,7 @@ type TemperatureGatewayMock struct {
 	temperatures map[string]Temperature
 }
 
-func (g *TemperatureGatewayMock) GetResourceAt(date string, resource interface{}) *HttpError {
+func (g *TemperatureGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
 	if reflect.DeepEqual(g.temperatures[date], Temperature{}) {
 		return &HttpError{http.StatusText(http.StatusNotFound), "Resource not found for " + date}
 	}
@@ -457,7 +1226,7 @@ type WindspeedGatewayMock struct {
 	speeds map[string]Windspeed
 }
 
-func (g *WindspeedGatewayMock) GetResourceAt(date string, resource interface{}) *HttpError {
+func (g *WindspeedGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
 	if reflect.DeepEqual(g.speeds[date], Windspeed{}) {
 		return &HttpError{http.StatusText(http.StatusNotFound), "Resource not found for " + date}
 	}
@@ -465,3 +1234,35 @@ func (g *WindspeedGatewayMock) GetResourceAt(date string, resource interface{})
 	_ = json.Unmarshal(jsonTemp, resource)
 	return nil
 }
+
+type delayedGatewayMock struct {
+	gateway Gateway
+	delays  map[string]time.Duration
+}
+
+func (g *delayedGatewayMock) GetResourceAt(ctx context.Context, date string, resource interface{}) *HttpError {
+	select {
+	case <-time.After(g.delays[date]):
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+	return g.gateway.GetResourceAt(ctx, date, resource)
+}
+
+type temperaturesResponse struct {
+	Data   []Temperature `json:"data"`
+	Errors []RangeError  `json:"errors"`
+	Units  *Units        `json:"units"`
+}
+
+type speedsResponse struct {
+	Data   []Windspeed  `json:"data"`
+	Errors []RangeError `json:"errors"`
+	Units  *Units       `json:"units"`
+}
+
+type weathersResponse struct {
+	Data   []Weather    `json:"data"`
+	Errors []RangeError `json:"errors"`
+	Next   string       `json:"next"`
+}
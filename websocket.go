@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+)
+
+const (
+	subscribeMessage    = "subscribe"
+	unsubscribeMessage  = "unsubscribe"
+	pingMessage         = "ping"
+	subscribedMessage   = "subscribed"
+	unsubscribedMessage = "unsubscribed"
+	observationMessage  = "observation"
+	errorMessage        = "error"
+	pongMessage         = "pong"
+
+	writeWait = time.Second * 10
+)
+
+// conditionMetrics are the Weather metrics a condition can test.
+var conditionMetrics = []string{"temp", "north", "west", magnitudeField, directionField, beaufortField, windChillField, apparentTempField}
+
+var conditionOperators = []string{"<", "<=", ">", ">=", "==", "!="}
+
+var upgrader = websocket.Upgrader{}
+
+// SubscriptionRequest is a message sent by a client on the websocket.
+// Subscribing again with the same id replaces the subscription.
+type SubscriptionRequest struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id,omitempty"`
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// SubscriptionEvent is a message sent to a client on the websocket.
+type SubscriptionEvent struct {
+	Type    string     `json:"type"`
+	ID      string     `json:"id,omitempty"`
+	EventID uint64     `json:"event_id,omitempty"`
+	Weather *Weather   `json:"weather,omitempty"`
+	Error   *HttpError `json:"error,omitempty"`
+}
+
+// Condition compares a metric of an observation to a threshold, eg. temp < 0.
+type Condition struct {
+	Metric    string
+	Operator  string
+	Threshold float64
+}
+
+// parseCondition reads a condition written as "<metric> <operator> <value>".
+// Wind metrics may be prefixed with wind, as in "wind magnitude > 20".
+func parseCondition(condition string) (Condition, *HttpError) {
+	parts := strings.Fields(condition)
+	if len(parts) == 4 && parts[0] == "wind" {
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return Condition{}, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide conditions as <metric> <operator> <value>"}
+	}
+	if !contains(conditionMetrics, parts[0]) {
+		return Condition{}, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a condition metric among " + strings.Join(conditionMetrics, ", ")}
+	}
+	if !contains(conditionOperators, parts[1]) {
+		return Condition{}, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a condition operator among " + strings.Join(conditionOperators, ", ")}
+	}
+	threshold, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return Condition{}, &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a numeric condition value"}
+	}
+	return Condition{parts[0], parts[1], threshold}, nil
+}
+
+// Matches reports whether the observation meets the condition. A metric
+// the observation lacks, such as an undefined wind chill, never matches.
+func (c Condition) Matches(weather Weather) bool {
+	value, ok := metricValue(weather, c.Metric)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case "<":
+		return value < c.Threshold
+	case "<=":
+		return value <= c.Threshold
+	case ">":
+		return value > c.Threshold
+	case ">=":
+		return value >= c.Threshold
+	case "==":
+		return value == c.Threshold
+	case "!=":
+		return value != c.Threshold
+	}
+	return false
+}
+
+func metricValue(weather Weather, metric string) (float64, bool) {
+	switch metric {
+	case "temp":
+		return weather.Temp, true
+	case "north":
+		return weather.North, true
+	case "west":
+		return weather.West, true
+	case magnitudeField:
+		return floatValue(weather.Magnitude)
+	case directionField:
+		return floatValue(weather.Direction)
+	case beaufortField:
+		if weather.Beaufort == nil {
+			return 0, false
+		}
+		return float64(*weather.Beaufort), true
+	case windChillField:
+		return floatValue(weather.WindChill)
+	case apparentTempField:
+		return floatValue(weather.ApparentTemp)
+	}
+	return 0, false
+}
+
+func floatValue(value *float64) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	return *value, true
+}
+
+// SubscribeWeather upgrades the connection to a websocket on which clients
+// subscribe to the live observations meeting every condition they list.
+// Observations carry every derived and comfort metric, in the upstream units
+// the conditions are also evaluated in. The server pings every heartbeat and
+// drops sockets that answered no pong within two heartbeats.
+func (m *Module) SubscribeWeather(c echo.Context) error {
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		m.logger.Error().Msg("Failed to upgrade to websocket: " + err.Error())
+		return nil
+	}
+	defer conn.Close()
+
+	// Only observations polled from now on are pushed.
+	_, observations, unsubscribe := m.live.Subscribe(^uint64(0))
+	defer unsubscribe()
+
+	requests := make(chan SubscriptionRequest)
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go m.readSubscriptions(conn, requests, closed, done)
+
+	options := allMetricsOptions(m.units)
+	subscriptions := make(map[string][]Condition)
+	ping := time.NewTicker(m.liveSettings.Heartbeat)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case request := <-requests:
+			err = writeSubscriptionEvent(conn, handleSubscription(subscriptions, request))
+		case observation, ok := <-observations:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down"), time.Now().Add(writeWait))
+				return nil
+			}
+			weather := options.apply(observation.Weather).(Weather)
+			for id, conditions := range subscriptions {
+				if err == nil && matchesAll(conditions, weather) {
+					err = writeSubscriptionEvent(conn, SubscriptionEvent{Type: observationMessage, ID: id, EventID: observation.ID, Weather: &weather})
+				}
+			}
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		case <-closed:
+			return nil
+		}
+		if err != nil {
+			m.logger.Error().Msg("Failed to write to websocket: " + err.Error())
+			return nil
+		}
+	}
+}
+
+// readSubscriptions forwards every request read on the websocket until the
+// socket fails, then closes closed, or until done is closed. A malformed
+// message is forwarded as a request of no type.
+func (m *Module) readSubscriptions(conn *websocket.Conn, requests chan<- SubscriptionRequest, closed chan<- struct{}, done <-chan struct{}) {
+	defer close(closed)
+
+	pongWait := 2 * m.liveSettings.Heartbeat
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var request SubscriptionRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			request = SubscriptionRequest{}
+		}
+		select {
+		case requests <- request:
+		case <-done:
+			return
+		}
+	}
+}
+
+// handleSubscription applies a request to the subscriptions of a socket and
+// returns the answer to send.
+func handleSubscription(subscriptions map[string][]Condition, request SubscriptionRequest) SubscriptionEvent {
+	switch request.Type {
+	case pingMessage:
+		return SubscriptionEvent{Type: pongMessage}
+	case subscribeMessage, unsubscribeMessage:
+		if request.ID == "" {
+			return SubscriptionEvent{Type: errorMessage, Error: &HttpError{http.StatusText(http.StatusBadRequest), "Please provide a subscription id"}}
+		}
+	default:
+		return SubscriptionEvent{Type: errorMessage, Error: &HttpError{http.StatusText(http.StatusBadRequest), "Please provide type among subscribe, unsubscribe, ping"}}
+	}
+
+	if request.Type == unsubscribeMessage {
+		if _, ok := subscriptions[request.ID]; !ok {
+			return SubscriptionEvent{Type: errorMessage, ID: request.ID, Error: &HttpError{http.StatusText(http.StatusNotFound), "Subscription not found for " + request.ID}}
+		}
+		delete(subscriptions, request.ID)
+		return SubscriptionEvent{Type: unsubscribedMessage, ID: request.ID}
+	}
+
+	conditions := []Condition{}
+	for _, value := range request.Conditions {
+		condition, err := parseCondition(value)
+		if err != nil {
+			return SubscriptionEvent{Type: errorMessage, ID: request.ID, Error: err}
+		}
+		conditions = append(conditions, condition)
+	}
+	subscriptions[request.ID] = conditions
+	return SubscriptionEvent{Type: subscribedMessage, ID: request.ID}
+}
+
+func matchesAll(conditions []Condition, weather Weather) bool {
+	for _, condition := range conditions {
+		if !condition.Matches(weather) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeSubscriptionEvent(conn *websocket.Conn, event SubscriptionEvent) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteJSON(event)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/suite"
+	"gotest.tools/assert"
+)
+
+type WebsocketTestSuite struct {
+	suite.Suite
+	module *Module
+	server *httptest.Server
+	conn   *websocket.Conn
+}
+
+func TestWebsocketTestSuite(t *testing.T) {
+	suite.Run(t, new(WebsocketTestSuite))
+}
+
+func (suite *WebsocketTestSuite) SetupTest() {
+	suite.module = newTestModule(suite.T(), DefaultConfig())
+	suite.module.liveSettings = LiveSettings{Interval: time.Millisecond * 10, Heartbeat: time.Second, History: 2, Buffer: 16}
+	suite.module.live = NewLivePoller(
+		suite.module.liveSettings,
+		&currentGatewayMock{value: Temperature{Temp: -5}},
+		&currentGatewayMock{value: Windspeed{North: 6, West: 8}},
+		suite.module.logger,
+	)
+	router := echo.New()
+	suite.module.RegisterRoutes(router)
+	suite.server = httptest.NewServer(router)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(suite.server.URL, "http")+"/weather/subscribe", nil)
+	assert.NilError(suite.T(), err)
+	suite.conn = conn
+}
+
+func (suite *WebsocketTestSuite) TearDownTest() {
+	suite.conn.Close()
+	suite.server.Close()
+}
+
+func (suite *WebsocketTestSuite) TestSubscriptionShouldOnlyPushMatchingObservations() {
+	// Given
+	suite.send(SubscriptionRequest{Type: subscribeMessage, ID: "high-wind", Conditions: []string{"wind magnitude > 20"}})
+	suite.send(SubscriptionRequest{Type: subscribeMessage, ID: "frost", Conditions: []string{"temp < 0", "beaufort >= 5"}})
+
+	// When
+	acks := []SubscriptionEvent{suite.receive(), suite.receive()}
+	event := suite.receive()
+
+	// Then
+	assert.DeepEqual(suite.T(), acks, []SubscriptionEvent{
+		{Type: subscribedMessage, ID: "high-wind"},
+		{Type: subscribedMessage, ID: "frost"},
+	})
+	assert.Equal(suite.T(), event.Type, observationMessage)
+	assert.Equal(suite.T(), event.ID, "frost")
+	assert.Equal(suite.T(), event.Weather.Temp, -5.0)
+	assert.Equal(suite.T(), *event.Weather.Magnitude, 10.0)
+}
+
+func (suite *WebsocketTestSuite) TestUnsubscribeShouldStopPushes() {
+	// Given
+	suite.send(SubscriptionRequest{Type: subscribeMessage, ID: "frost", Conditions: []string{"temp < 0"}})
+	suite.receive()
+
+	// When
+	suite.send(SubscriptionRequest{Type: unsubscribeMessage, ID: "frost"})
+
+	// Then
+	for {
+		event := suite.receive()
+		if event.Type == unsubscribedMessage {
+			assert.Equal(suite.T(), event.ID, "frost")
+			break
+		}
+		assert.Equal(suite.T(), event.Type, observationMessage)
+	}
+	suite.send(SubscriptionRequest{Type: pingMessage})
+	assert.DeepEqual(suite.T(), suite.receive(), SubscriptionEvent{Type: pongMessage})
+}
+
+func (suite *WebsocketTestSuite) TestSubscribeShouldRejectMalformedConditions() {
+	// When
+	suite.send(SubscriptionRequest{Type: subscribeMessage, ID: "frost", Conditions: []string{"humidity > 90"}})
+
+	// Then
+	event := suite.receive()
+	assert.Equal(suite.T(), event.Type, errorMessage)
+	assert.Equal(suite.T(), event.ID, "frost")
+	assert.DeepEqual(suite.T(), *event.Error, HttpError{
+		Type:    http.StatusText(http.StatusBadRequest),
+		Message: "Please provide a condition metric among temp, north, west, magnitude, direction, beaufort, wind_chill, apparent_temp",
+	})
+}
+
+func (suite *WebsocketTestSuite) TestServerShouldAnswerPingFrames() {
+	// Given
+	pong := make(chan string, 1)
+	suite.conn.SetPongHandler(func(data string) error {
+		pong <- data
+		return nil
+	})
+
+	// When
+	assert.NilError(suite.T(), suite.conn.WriteControl(websocket.PingMessage, []byte("keepalive"), time.Now().Add(time.Second)))
+	go suite.conn.ReadMessage()
+
+	// Then
+	select {
+	case data := <-pong:
+		assert.Equal(suite.T(), data, "keepalive")
+	case <-time.After(time.Second):
+		suite.T().Fatal("no pong received")
+	}
+}
+
+func (suite *WebsocketTestSuite) send(request SubscriptionRequest) {
+	assert.NilError(suite.T(), suite.conn.WriteJSON(request))
+}
+
+func (suite *WebsocketTestSuite) receive() SubscriptionEvent {
+	var event SubscriptionEvent
+	_ = suite.conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NilError(suite.T(), suite.conn.ReadJSON(&event))
+	return event
+}